@@ -0,0 +1,83 @@
+package rmlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmaudit"
+)
+
+var ErrAuditNotConfigured = errors.New("rmlog: audit pipeline is not configured, call SetupAudit")
+
+var auditState struct {
+	mu      sync.RWMutex
+	handler *handler.CustomHandler
+	sink    *rmaudit.Sink
+}
+
+// SetupAudit opens the audit pipeline used by Audit. It is separate from
+// Setup: no level, filters, sampling or redaction apply to it and reloads
+// leave it alone. config.SyncInterval sets the fsync cadence, MaxSize,
+// MaxAge and MaxFiles the retention of rotated files.
+func SetupAudit(config rmaudit.Config) error {
+	sink, err := rmaudit.New(config)
+	if err != nil {
+		return err
+	}
+
+	h := handler.NewCustomHandler(io.Discard, slog.LevelDebug, true, false).
+		SetName("audit").
+		AddSink(sink)
+
+	auditState.mu.Lock()
+	previous := auditState.sink
+	auditState.handler, auditState.sink = h, sink
+	auditState.mu.Unlock()
+
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+// Audit writes a business audit event to the hash-chained audit log. It
+// blocks until the record is written and returns an error instead of
+// dropping it, callers should treat that error like a failed transaction.
+func Audit(ctx context.Context, event string, args ...any) error {
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, event, pcs[0])
+	r.Add(args...)
+
+	auditState.mu.RLock()
+	defer auditState.mu.RUnlock()
+
+	err := ErrAuditNotConfigured
+	if auditState.handler != nil {
+		err = auditState.handler.Handle(ctx, r)
+	}
+	if err != nil {
+		handler.Log.ErrorContext(ctx, "audit event not written", "event", event, "error", err)
+		return fmt.Errorf("rmlog: audit event %q not written: %w", event, err)
+	}
+	return nil
+}
+
+func closeAudit() error {
+	auditState.mu.Lock()
+	defer auditState.mu.Unlock()
+
+	if auditState.sink == nil {
+		return nil
+	}
+	err := auditState.sink.Close()
+	auditState.handler, auditState.sink = nil, nil
+	return err
+}
@@ -0,0 +1,70 @@
+package rmlog
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmaudit"
+)
+
+var auditKey = []byte("audit-test-key")
+
+func setupAudit(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := SetupAudit(rmaudit.Config{Path: path, Key: auditKey}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeAudit() })
+	return path
+}
+
+func TestAuditNotConfigured(t *testing.T) {
+	closeAudit()
+
+	if err := Audit(context.Background(), "user.deleted"); !errors.Is(err, ErrAuditNotConfigured) {
+		t.Errorf("error = %v, want ErrAuditNotConfigured", err)
+	}
+}
+
+func TestAuditBypassesPipeline(t *testing.T) {
+	rate := 0.0
+	err := Setup(Config{
+		Level:    "error",
+		Output:   filepath.Join(t.TempDir(), "app.log"),
+		Filters:  []string{"drop if msg^=user."},
+		Sampling: SamplingConfig{Rate: &rate, KeepLevel: "error"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Shutdown() })
+	path := setupAudit(t)
+
+	events := []string{"user.created", "user.deleted", "order.refunded"}
+	for _, event := range events {
+		if err := Audit(context.Background(), event, "actor", "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := rmaudit.VerifyFile(path, auditKey, rmaudit.VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Records != len(events) {
+		t.Errorf("audit log has %d records, problems %v, want %d intact records", report.Records, report.Problems, len(events))
+	}
+}
+
+func TestAuditReturnsSinkErrors(t *testing.T) {
+	setupAudit(t)
+
+	auditState.sink.Close()
+	err := Audit(context.Background(), "user.deleted")
+	if err == nil || errors.Is(err, ErrAuditNotConfigured) {
+		t.Errorf("error = %v, want the sink's write error", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Command rmaudit verifies hash-chained audit logs written by rmaudit.Sink.
+//
+//	rmaudit [-key-env RMLOG_AUDIT_KEY | -key-file path] [-anchor-seq N -anchor-mac HEX] [-seq N -mac HEX] file...
+//
+// Files are verified as consecutive parts of one chain, so pass rotated
+// files oldest first followed by the live file. The first file must start
+// the chain unless -anchor-seq and -anchor-mac give the head it continues,
+// -seq and -mac are checked against the end of the last file.
+//
+// It exits with status 1 when any file has problems and 2 on usage errors.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmaudit"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("rmaudit", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	keyEnv := flags.String("key-env", "RMLOG_AUDIT_KEY", "environment variable holding the HMAC key")
+	keyFile := flags.String("key-file", "", "file holding the HMAC key, overrides -key-env")
+	seq := flags.Uint64("seq", 0, "expected last sequence number")
+	mac := flags.String("mac", "", "expected last mac")
+	anchorSeq := flags.Uint64("anchor-seq", 0, "sequence number the first file continues from")
+	anchorMAC := flags.String("anchor-mac", "", "mac the first file continues from")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: rmaudit [flags] file...")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	key := []byte(os.Getenv(*keyEnv))
+	if *keyFile != "" {
+		data, err := os.ReadFile(*keyFile)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		key = []byte(strings.TrimRight(string(data), "\r\n"))
+	}
+	if len(key) == 0 {
+		fmt.Fprintln(stderr, "rmaudit: no key, set -key-env or -key-file")
+		return 2
+	}
+
+	failed := false
+	opts := rmaudit.VerifyOptions{AnchorSeq: *anchorSeq, AnchorMAC: *anchorMAC}
+	for i, path := range flags.Args() {
+		if i == flags.NArg()-1 {
+			opts.ExpectSeq, opts.ExpectMAC = *seq, *mac
+		}
+		report, err := rmaudit.VerifyFile(path, key, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		if report.Records > 0 {
+			opts.AnchorSeq, opts.AnchorMAC = report.LastSeq, report.LastMAC
+		}
+
+		for _, problem := range report.Problems {
+			fmt.Fprintf(stdout, "%s: %s\n", path, problem)
+		}
+		status := "OK"
+		if !report.OK() {
+			status = "FAILED"
+			failed = true
+		}
+		fmt.Fprintf(stdout, "%s: %s, %d records, seq %d..%d\n", path, status, report.Records, report.FirstSeq, report.LastSeq)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
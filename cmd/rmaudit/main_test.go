@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmaudit"
+)
+
+const testKey = "cmd-test-key"
+
+// writeChain writes a rotated file with two records and a live file with
+// one, and returns the paths oldest first with the head of the chain.
+func writeChain(t *testing.T) ([]string, uint64, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := rmaudit.New(rmaudit.Config{Path: path, Key: []byte(testKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	entry := core.Entry{Time: time.Now(), Message: "audited"}
+	sink.Write(context.Background(), entry)
+	sink.Write(context.Background(), entry)
+	if err := sink.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(context.Background(), entry)
+
+	rotated, err := sink.Rotated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, mac := sink.Head()
+	return append(rotated, path), seq, mac
+}
+
+func TestRun(t *testing.T) {
+	files, seq, mac := writeChain(t)
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(testKey+"\n"), 0o600)
+
+	tampered := filepath.Join(t.TempDir(), "tampered.log")
+	data, _ := os.ReadFile(files[0])
+	os.WriteFile(tampered, bytes.Replace(data, []byte("audited"), []byte("rewritten"), 1), 0o600)
+
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want int
+	}{
+		{name: "chain across files", env: testKey, args: files, want: 0},
+		{name: "key file", args: append([]string{"-key-file", keyFile}, files...), want: 0},
+		{name: "expected head", env: testKey, args: append([]string{"-seq", strconv.FormatUint(seq, 10), "-mac", mac}, files...), want: 0},
+		{name: "wrong head", env: testKey, args: append([]string{"-seq", strconv.FormatUint(seq+1, 10)}, files...), want: 1},
+		{name: "live file without anchor", env: testKey, args: files[1:], want: 1},
+		{name: "tampered file", env: testKey, args: []string{tampered}, want: 1},
+		{name: "missing file", env: testKey, args: []string{filepath.Join(t.TempDir(), "missing")}, want: 1},
+		{name: "wrong key", env: "other key", args: files, want: 1},
+		{name: "no files", env: testKey, want: 2},
+		{name: "no key", args: files, want: 2},
+		{name: "unknown flag", env: testKey, args: []string{"-bogus"}, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RMLOG_AUDIT_KEY", tt.env)
+
+			var stdout, stderr bytes.Buffer
+			if got := run(tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("exit code = %d, want %d\nstdout: %s\nstderr: %s", got, tt.want, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package rmlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+)
+
+const ConfigEnvKey = "RMLOG_CONFIG"
+
+type Config struct {
+	Level string `json:"level"`
+	// Loggers sets levels for Named loggers by name prefix, e.g. {"billing": "debug"}.
+	Loggers map[string]string `json:"loggers"`
+	// Format is "text" or "json".
+	Format string `json:"format"`
+	// Source is "full", "short" or "none".
+	Source string `json:"source"`
+	// Output is "stdout", "stderr" or a file path.
+	Output    string          `json:"output"`
+	Sinks     []SinkConfig    `json:"sinks"`
+	Filters   []string        `json:"filters"`
+	Redaction RedactionConfig `json:"redaction"`
+	Sampling  SamplingConfig  `json:"sampling"`
+	Limits    LimitsConfig    `json:"limits"`
+	Sentry    SentryConfig    `json:"sentry"`
+	// SpanThreshold only logs successful spans slower than this, at warn.
+	SpanThreshold Duration `json:"span_threshold"`
+}
+
+type SinkConfig struct {
+	// Type is one of syslog, journald, gelf, loki, elasticsearch, otlp, webhook or forward.
+	Type        string            `json:"type"`
+	Name        string            `json:"name,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Network     string            `json:"network,omitempty"`
+	Address     string            `json:"address,omitempty"`
+	Format      string            `json:"format,omitempty"`
+	Compression string            `json:"compression,omitempty"`
+	Index       string            `json:"index,omitempty"`
+	DateLayout  string            `json:"date_layout,omitempty"`
+	Tag         string            `json:"tag,omitempty"`
+	ServiceName string            `json:"service_name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	LabelAttrs  []string          `json:"label_attrs,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Password    string            `json:"password,omitempty"`
+	APIKey      string            `json:"api_key,omitempty"`
+	BearerToken string            `json:"bearer_token,omitempty"`
+	Gzip        bool              `json:"gzip,omitempty"`
+	BatchSize   int               `json:"batch_size,omitempty"`
+	// FlushInterval accepts Go durations such as "5s".
+	FlushInterval Duration `json:"flush_interval,omitempty"`
+}
+
+type RedactionConfig struct {
+	Keys        []string `json:"keys"`
+	Replacement string   `json:"replacement"`
+}
+
+type SamplingConfig struct {
+	// Rate is the fraction of records below KeepLevel that are kept, nil disables sampling.
+	Rate      *float64 `json:"rate"`
+	KeepLevel string   `json:"keep_level"`
+}
+
+type LimitsConfig struct {
+	MaxMessageLength int `json:"max_message_length"`
+	MaxValueLength   int `json:"max_value_length"`
+	MaxAttrs         int `json:"max_attrs"`
+	MaxRecordBytes   int `json:"max_record_bytes"`
+}
+
+type SentryConfig struct {
+	Enabled     bool     `json:"enabled"`
+	DSN         string   `json:"dsn"`
+	Environment string   `json:"environment"`
+	Release     string   `json:"release"`
+	SampleRate  float64  `json:"sample_rate"`
+	Levels      []string `json:"levels"`
+}
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\" or nanoseconds")
+	}
+	*d = Duration(n)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type ConfigError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("rmlog config: %s: %v", e.Field, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Level:  "warn",
+		Format: "text",
+		Source: "full",
+		Output: "stdout",
+	}
+}
+
+// LoadConfig reads a JSON file, applies RMLOG_* environment overrides and
+// validates the result. An empty path falls back to $RMLOG_CONFIG, and to
+// defaults plus environment when that is unset too.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if path == "" {
+		path = os.Getenv(ConfigEnvKey)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, &ConfigError{Field: path, Err: err}
+		}
+		if err := ParseConfig(data, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.ApplyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func ParseConfig(data []byte, cfg *Config) error {
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return &ConfigError{Field: typeErr.Field, Err: err}
+		}
+		return &ConfigError{Field: "json", Err: err}
+	}
+	return nil
+}
+
+// ApplyEnv overrides fields from RMLOG_LEVEL, RMLOG_FORMAT, RMLOG_SOURCE,
+// RMLOG_OUTPUT, RMLOG_LOGGER_LEVELS, RMLOG_SINKS, RMLOG_FILTERS, RMLOG_REDACT_KEYS,
+// RMLOG_SAMPLING_RATE, RMLOG_SAMPLING_KEEP_LEVEL, RMLOG_SPAN_THRESHOLD and
+// RMLOG_SENTRY_*.
+func (c *Config) ApplyEnv() error {
+	setString := func(key string, target *string) {
+		if value, ok := os.LookupEnv(key); ok {
+			*target = value
+		}
+	}
+
+	setString("RMLOG_LEVEL", &c.Level)
+	setString("RMLOG_FORMAT", &c.Format)
+	setString("RMLOG_SOURCE", &c.Source)
+	setString("RMLOG_OUTPUT", &c.Output)
+	setString("RMLOG_SAMPLING_KEEP_LEVEL", &c.Sampling.KeepLevel)
+	setString("RMLOG_SENTRY_ENVIRONMENT", &c.Sentry.Environment)
+	setString("RMLOG_SENTRY_RELEASE", &c.Sentry.Release)
+
+	if value, ok := os.LookupEnv("RMLOG_SINKS"); ok {
+		c.Sinks = parseSinksEnv(value)
+	}
+	if value, ok := os.LookupEnv("RMLOG_LOGGER_LEVELS"); ok {
+		c.Loggers = make(map[string]string)
+		for _, pair := range splitList(value, ",") {
+			name, level, _ := strings.Cut(pair, "=")
+			c.Loggers[strings.TrimSpace(name)] = strings.TrimSpace(level)
+		}
+	}
+	if value, ok := os.LookupEnv("RMLOG_FILTERS"); ok {
+		c.Filters = splitList(value, ";")
+	}
+	if value, ok := os.LookupEnv("RMLOG_REDACT_KEYS"); ok {
+		c.Redaction.Keys = splitList(value, ",")
+	}
+	if value, ok := os.LookupEnv("RMLOG_SAMPLING_RATE"); ok {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return &ConfigError{Field: "RMLOG_SAMPLING_RATE", Err: err}
+		}
+		c.Sampling.Rate = &rate
+	}
+	if value, ok := os.LookupEnv("RMLOG_SPAN_THRESHOLD"); ok {
+		threshold, err := time.ParseDuration(value)
+		if err != nil {
+			return &ConfigError{Field: "RMLOG_SPAN_THRESHOLD", Err: err}
+		}
+		c.SpanThreshold = Duration(threshold)
+	}
+	if value, ok := os.LookupEnv("RMLOG_SENTRY_DSN"); ok {
+		c.Sentry.DSN = value
+		c.Sentry.Enabled = value != ""
+	}
+	if value, ok := os.LookupEnv("RMLOG_SENTRY_LEVELS"); ok {
+		c.Sentry.Levels = splitList(value, ",")
+	}
+
+	return nil
+}
+
+// parseSinksEnv reads "type=target" pairs separated by commas, e.g.
+// "loki=http://loki:3100/loki/api/v1/push,syslog=udp://127.0.0.1:514,journald".
+func parseSinksEnv(value string) []SinkConfig {
+	var sinks []SinkConfig
+	for _, spec := range splitList(value, ",") {
+		sinkType, target, _ := strings.Cut(spec, "=")
+		sink := SinkConfig{Type: strings.TrimSpace(sinkType)}
+
+		switch sink.Type {
+		case "loki", "elasticsearch", "otlp", "webhook":
+			sink.URL = target
+		default:
+			if network, address, ok := strings.Cut(target, "://"); ok {
+				sink.Network = network
+				sink.Address = address
+			} else {
+				sink.Address = target
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks
+}
+
+func splitList(value, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate reports every invalid field, each error is a *ConfigError.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(field string, format string, args ...any) {
+		errs = append(errs, &ConfigError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+
+	if _, err := parseLevel(c.Level); err != nil {
+		fail("level", "%v", err)
+	}
+	for name, level := range c.Loggers {
+		if name == "" {
+			fail("loggers", "logger name must not be empty")
+		}
+		if _, err := parseLevel(level); err != nil || level == "" {
+			fail(fmt.Sprintf("loggers[%q]", name), "unknown level %q", level)
+		}
+	}
+	switch c.Format {
+	case "", "text", "json":
+	default:
+		fail("format", "must be text or json, got %q", c.Format)
+	}
+	switch c.Source {
+	case "", "full", "short", "none":
+	default:
+		fail("source", "must be full, short or none, got %q", c.Source)
+	}
+
+	for i, sink := range c.Sinks {
+		if err := sink.validate(); err != nil {
+			fail(fmt.Sprintf("sinks[%d].%s", i, err.Field), "%v", err.Err)
+		}
+	}
+
+	for i, rule := range c.Filters {
+		if _, err := handler.CompileFilter(rule); err != nil {
+			fail(fmt.Sprintf("filters[%d]", i), "%v", err)
+		}
+	}
+
+	if c.Sampling.Rate != nil && (*c.Sampling.Rate < 0 || *c.Sampling.Rate > 1) {
+		fail("sampling.rate", "must be between 0 and 1, got %v", *c.Sampling.Rate)
+	}
+	if c.Sampling.KeepLevel != "" {
+		if _, err := parseLevel(c.Sampling.KeepLevel); err != nil {
+			fail("sampling.keep_level", "%v", err)
+		}
+	}
+
+	limits := map[string]int{
+		"limits.max_message_length": c.Limits.MaxMessageLength,
+		"limits.max_value_length":   c.Limits.MaxValueLength,
+		"limits.max_attrs":          c.Limits.MaxAttrs,
+		"limits.max_record_bytes":   c.Limits.MaxRecordBytes,
+	}
+	for field, value := range limits {
+		if value < 0 {
+			fail(field, "must not be negative")
+		}
+	}
+
+	if c.SpanThreshold < 0 {
+		fail("span_threshold", "must not be negative")
+	}
+
+	if c.Sentry.Enabled && c.Sentry.DSN == "" {
+		fail("sentry.dsn", "is required when sentry is enabled")
+	}
+	for i, level := range c.Sentry.Levels {
+		if _, err := parseLevel(level); err != nil {
+			fail(fmt.Sprintf("sentry.levels[%d]", i), "%v", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s SinkConfig) validate() *ConfigError {
+	required := func(field, value string) *ConfigError {
+		if value == "" {
+			return &ConfigError{Field: field, Err: fmt.Errorf("is required for %s sinks", s.Type)}
+		}
+		return nil
+	}
+
+	switch s.Type {
+	case "journald":
+		return nil
+	case "syslog":
+		if s.Format != "" && s.Format != "rfc5424" && s.Format != "rfc3164" {
+			return &ConfigError{Field: "format", Err: fmt.Errorf("must be rfc5424 or rfc3164, got %q", s.Format)}
+		}
+		return nil
+	case "forward":
+		return required("address", s.Address)
+	case "gelf":
+		if s.Compression != "" && s.Compression != "none" && s.Compression != "gzip" && s.Compression != "zlib" {
+			return &ConfigError{Field: "compression", Err: fmt.Errorf("must be none, gzip or zlib, got %q", s.Compression)}
+		}
+		return required("address", s.Address)
+	case "loki", "otlp":
+		return required("url", s.URL)
+	case "elasticsearch":
+		if err := required("url", s.URL); err != nil {
+			return err
+		}
+		return required("index", s.Index)
+	case "webhook":
+		if s.Format != "" && s.Format != "json_array" && s.Format != "ndjson" && s.Format != "envelope" {
+			return &ConfigError{Field: "format", Err: fmt.Errorf("must be json_array, ndjson or envelope, got %q", s.Format)}
+		}
+		return required("url", s.URL)
+	case "":
+		return &ConfigError{Field: "type", Err: errors.New("is required")}
+	default:
+		return &ConfigError{Field: "type", Err: fmt.Errorf("unknown sink type %q", s.Type)}
+	}
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelWarn, nil
+	}
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return level, fmt.Errorf("unknown level %q", s)
+	}
+	return level, nil
+}
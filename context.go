@@ -0,0 +1,20 @@
+package rmlog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return core.ContextWithLogger(ctx, logger)
+}
+
+// FromContext returns the logger stored by WithLogger, or Log.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := core.LoggerFromContext(ctx); ok {
+		return logger
+	}
+	return Log
+}
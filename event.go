@@ -0,0 +1,357 @@
+package rmlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+const EventKey = "event"
+
+// Event is a registered event type. Records carry an event group with
+// name, version and data, data holds the payload fields keyed by their
+// json names so every sink sees the same shape.
+type Event[T any] struct {
+	name    string
+	version int
+	level   slog.Level
+}
+
+type eventSpec struct {
+	name    string
+	version int
+	typ     reflect.Type
+}
+
+var eventRegistry = struct {
+	mu    sync.RWMutex
+	specs map[string]eventSpec
+}{specs: make(map[string]eventSpec)}
+
+// RegisterEvent registers T as version of the event name and panics when
+// that pair is already registered or T is not a struct, like regexp.MustCompile
+// it is meant for package level vars:
+//
+//	var OrderCreated = rmlog.RegisterEvent[OrderCreatedEvent]("order.created", 1)
+func RegisterEvent[T any](name string, version int) *Event[T] {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("rmlog: event %s payload must be a struct, got %s", name, typ))
+	}
+	if name == "" || version <= 0 {
+		panic("rmlog: event needs a name and a positive version")
+	}
+
+	key := eventKey(name, version)
+	eventRegistry.mu.Lock()
+	defer eventRegistry.mu.Unlock()
+	if existing, ok := eventRegistry.specs[key]; ok {
+		panic(fmt.Sprintf("rmlog: event %s already registered with %s", key, existing.typ))
+	}
+	eventRegistry.specs[key] = eventSpec{name: name, version: version, typ: typ}
+
+	return &Event[T]{name: name, version: version, level: slog.LevelInfo}
+}
+
+// WithLevel returns a copy of e that logs at level instead of info.
+func (e *Event[T]) WithLevel(level slog.Level) *Event[T] {
+	clone := *e
+	clone.level = level
+	return &clone
+}
+
+func (e *Event[T]) Name() string {
+	return e.name
+}
+
+func (e *Event[T]) Version() int {
+	return e.version
+}
+
+// Attr encodes payload as the event group.
+func (e *Event[T]) Attr(payload T) slog.Attr {
+	return slog.Group(EventKey,
+		slog.String("name", e.name),
+		slog.Int("version", e.version),
+		slog.Attr{Key: "data", Value: eventValue(reflect.ValueOf(payload), 0)},
+	)
+}
+
+// Log writes the event to Log with the event name as message.
+func (e *Event[T]) Log(ctx context.Context, payload T, args ...any) {
+	e.log(ctx, Log, payload, args)
+}
+
+func (e *Event[T]) LogTo(ctx context.Context, logger *slog.Logger, payload T, args ...any) {
+	e.log(ctx, logger, payload, args)
+}
+
+func (e *Event[T]) log(ctx context.Context, logger *slog.Logger, payload T, args []any) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !logger.Enabled(ctx, e.level) {
+		return
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), e.level, e.name, pcs[0])
+	r.AddAttrs(e.Attr(payload))
+	r.Add(args...)
+	logger.Handler().Handle(ctx, r)
+}
+
+func eventKey(name string, version int) string {
+	return fmt.Sprintf("%s@v%d", name, version)
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+type eventField struct {
+	name     string
+	index    []int
+	optional bool
+}
+
+// eventFields lists exported fields by json name, embedded structs without
+// a tag are flattened like encoding/json does.
+func eventFields(typ reflect.Type) []eventField {
+	var fields []eventField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, inner := range eventFields(field.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, eventField{
+			name:     name,
+			index:    []int{i},
+			optional: strings.Contains(options, "omitempty") || field.Type.Kind() == reflect.Pointer,
+		})
+	}
+	return fields
+}
+
+// maxEventDepth bounds how deep eventValue descends, so a payload whose
+// pointers lead back to itself cannot recurse forever.
+const maxEventDepth = 32
+
+func eventValue(v reflect.Value, depth int) slog.Value {
+	if !v.IsValid() {
+		return slog.AnyValue(nil)
+	}
+	if depth >= maxEventDepth {
+		return slog.StringValue("<max depth exceeded>")
+	}
+	depth++
+
+	switch {
+	case v.Type() == timeType:
+		return slog.TimeValue(v.Interface().(time.Time))
+	case v.Type() == durationType:
+		return slog.DurationValue(time.Duration(v.Int()))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return slog.AnyValue(nil)
+		}
+		return eventValue(v.Elem(), depth)
+	case reflect.Struct:
+		fields := eventFields(v.Type())
+		attrs := make([]slog.Attr, 0, len(fields))
+		for _, field := range fields {
+			attrs = append(attrs, slog.Attr{Key: field.name, Value: eventValue(v.FieldByIndex(field.index), depth)})
+		}
+		// Handlers drop empty groups, the schema still requires the object.
+		if len(attrs) == 0 {
+			return slog.AnyValue(map[string]any{})
+		}
+		return slog.GroupValue(attrs...)
+	case reflect.String:
+		return slog.StringValue(v.String())
+	case reflect.Bool:
+		return slog.BoolValue(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return slog.Int64Value(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return slog.Uint64Value(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return slog.Float64Value(v.Float())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return slog.AnyValue(data)
+		}
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = core.ValueToAny(eventValue(v.Index(i), depth))
+		}
+		return slog.AnyValue(items)
+	case reflect.Map:
+		entries := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			entries[fmt.Sprint(iter.Key().Interface())] = core.ValueToAny(eventValue(iter.Value(), depth))
+		}
+		return slog.AnyValue(entries)
+	default:
+		return slog.AnyValue(v.Interface())
+	}
+}
+
+// EventCatalog returns a JSON Schema (draft 2020-12) describing the event
+// group of every registered event, keyed by "name@vN".
+func EventCatalog() map[string]any {
+	eventRegistry.mu.RLock()
+	specs := make([]eventSpec, 0, len(eventRegistry.specs))
+	for _, spec := range eventRegistry.specs {
+		specs = append(specs, spec)
+	}
+	eventRegistry.mu.RUnlock()
+	sort.Slice(specs, func(i, j int) bool {
+		return eventKey(specs[i].name, specs[i].version) < eventKey(specs[j].name, specs[j].version)
+	})
+
+	defs := make(map[string]any, len(specs))
+	refs := make([]any, 0, len(specs))
+	schemas := &schemaBuilder{defs: defs, names: make(map[reflect.Type]string)}
+	for _, spec := range specs {
+		key := eventKey(spec.name, spec.version)
+		defs[key] = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":    map[string]any{"const": spec.name},
+				"version": map[string]any{"const": spec.version},
+				"data":    schemas.typeSchema(spec.typ),
+			},
+			"required":             []string{"name", "version", "data"},
+			"additionalProperties": false,
+		}
+		refs = append(refs, defRef(key))
+	}
+
+	return map[string]any{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   EventKey,
+		"oneOf":   refs,
+		"$defs":   defs,
+	}
+}
+
+func WriteEventCatalog(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(EventCatalog())
+}
+
+// schemaBuilder collects named struct types under $defs so recursive
+// payloads end in a $ref instead of expanding forever.
+type schemaBuilder struct {
+	defs  map[string]any
+	names map[reflect.Type]string
+}
+
+func (b *schemaBuilder) typeSchema(typ reflect.Type) map[string]any {
+	switch typ {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Pointer:
+		schema := b.typeSchema(typ.Elem())
+		return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return b.structSchema(typ)
+		}
+		if name, ok := b.names[typ]; ok {
+			return defRef(name)
+		}
+		name := typ.String()
+		for i := 2; b.defs[name] != nil; i++ {
+			name = fmt.Sprintf("%s_%d", typ.String(), i)
+		}
+		b.names[typ] = name
+		b.defs[name] = map[string]any{}
+		b.defs[name] = b.structSchema(typ)
+		return defRef(name)
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.typeSchema(typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.typeSchema(typ.Elem())}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (b *schemaBuilder) structSchema(typ reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	required := []string{}
+	for _, field := range eventFields(typ) {
+		properties[field.name] = b.typeSchema(typ.FieldByIndex(field.index).Type)
+		if !field.optional {
+			required = append(required, field.name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// defRef points at a $defs entry, escaping name as a JSON pointer token.
+func defRef(name string) map[string]any {
+	name = strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+	return map[string]any{"$ref": "#/$defs/" + name}
+}
@@ -0,0 +1,205 @@
+package rmlog
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+)
+
+const LoggerKey = "logger"
+
+// Logger is a component logger created by Named. It writes through Log, so
+// Setup and reloads apply to it, and adds a logger field with its name.
+type Logger struct {
+	*slog.Logger
+	name string
+}
+
+// maxKnownLoggers caps how many names Loggers remembers, so names built
+// from request data cannot grow the registry without bound.
+const maxKnownLoggers = 1024
+
+// Named returns the logger for a component, nested names are joined with
+// dots: Named("billing").Named("invoices") is "billing.invoices".
+func Named(name string) *Logger {
+	registry.mu.Lock()
+	known := registry.known[name]
+	if !known && len(registry.known) < maxKnownLoggers {
+		registry.known[name] = true
+		known = true
+	}
+	registry.mu.Unlock()
+
+	return &Logger{
+		Logger: slog.New(&namedHandler{name: name, counted: known}),
+		name:   name,
+	}
+}
+
+func (l *Logger) Named(name string) *Logger {
+	return Named(l.name + "." + name)
+}
+
+func (l *Logger) Name() string {
+	return l.name
+}
+
+var registry = struct {
+	mu     sync.RWMutex
+	known  map[string]bool
+	levels map[string]slog.Level
+}{
+	known:  make(map[string]bool),
+	levels: make(map[string]slog.Level),
+}
+
+// SetLoggerLevel sets the level for name and every logger below it that has
+// no level of its own.
+func SetLoggerLevel(name string, level slog.Level) {
+	registry.mu.Lock()
+	registry.levels[name] = level
+	registry.mu.Unlock()
+}
+
+// ResetLoggerLevel makes name inherit its level again.
+func ResetLoggerLevel(name string) {
+	registry.mu.Lock()
+	delete(registry.levels, name)
+	registry.mu.Unlock()
+}
+
+// LoggerLevel returns the level for name and the prefix it was set on,
+// ok is false when name uses the level of Log.
+func LoggerLevel(name string) (level slog.Level, from string, ok bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	for prefix := name; prefix != ""; {
+		if level, ok := registry.levels[prefix]; ok {
+			return level, prefix, true
+		}
+		i := strings.LastIndexByte(prefix, '.')
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return 0, "", false
+}
+
+type LoggerInfo = core.LoggerInfo
+
+// LoggerRegistry exposes the named logger functions as methods, for
+// packages that cannot import rmlog: rmfiber.LevelsHandler(rmlog.Levels).
+type LoggerRegistry struct{}
+
+var Levels LoggerRegistry
+
+func (LoggerRegistry) Loggers() []LoggerInfo {
+	return Loggers()
+}
+
+func (LoggerRegistry) SetLoggerLevel(name string, level slog.Level) {
+	SetLoggerLevel(name, level)
+}
+
+func (LoggerRegistry) ResetLoggerLevel(name string) {
+	ResetLoggerLevel(name)
+}
+
+// Loggers lists named loggers, up to maxKnownLoggers of them, and every
+// name with a level set, sorted.
+func Loggers() []LoggerInfo {
+	registry.mu.RLock()
+	names := make([]string, 0, len(registry.known)+len(registry.levels))
+	for name := range registry.known {
+		names = append(names, name)
+	}
+	for name := range registry.levels {
+		if !registry.known[name] {
+			names = append(names, name)
+		}
+	}
+	registry.mu.RUnlock()
+	sort.Strings(names)
+
+	infos := make([]LoggerInfo, 0, len(names))
+	for _, name := range names {
+		info := LoggerInfo{Name: name}
+		if level, from, ok := LoggerLevel(name); ok {
+			info.Level = level.String()
+			if from != name {
+				info.InheritedFrom = from
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// namedHandler resolves Log on every call so loggers created before Setup
+// follow it, the derived handler is cached until Log changes.
+type namedHandler struct {
+	name string
+	// counted labels RecordsTotal with name, only for names within
+	// maxKnownLoggers so the metric stays bounded too.
+	counted bool
+	ops     []func(slog.Handler) slog.Handler
+	cache   atomic.Pointer[namedCache]
+}
+
+type namedCache struct {
+	base    slog.Handler
+	derived slog.Handler
+}
+
+func (h *namedHandler) resolve() slog.Handler {
+	base := Log.Handler()
+	if cached := h.cache.Load(); cached != nil && cached.base == base {
+		return cached.derived
+	}
+
+	derived := base.WithAttrs([]slog.Attr{slog.String(LoggerKey, h.name)})
+	for _, op := range h.ops {
+		derived = op(derived)
+	}
+	h.cache.Store(&namedCache{base: base, derived: derived})
+	return derived
+}
+
+func (h *namedHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if min, _, ok := LoggerLevel(h.name); ok {
+		return level >= min
+	}
+	return h.resolve().Enabled(ctx, level)
+}
+
+func (h *namedHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.counted {
+		ctx = handler.ContextWithLoggerName(ctx, h.name)
+	}
+	if _, _, ok := LoggerLevel(h.name); ok {
+		ctx = handler.ContextWithLevelChecked(ctx)
+	}
+	return h.resolve().Handle(ctx, r)
+}
+
+func (h *namedHandler) with(op func(slog.Handler) slog.Handler) *namedHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &namedHandler{name: h.name, counted: h.counted, ops: append(ops, op)}
+}
+
+func (h *namedHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *namedHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
@@ -0,0 +1,139 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBatcherFull = errors.New("batcher queue is full")
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+type BatchConfig struct {
+	// MaxSize flushes the batch once this many items are pending.
+	MaxSize int
+	// Interval flushes pending items at least this often.
+	Interval time.Duration
+	// MaxPending bounds the queue, further items are rejected with ErrBatcherFull.
+	MaxPending int
+	// OnError receives errors from background flushes.
+	OnError func(error)
+}
+
+type Batcher[T any] struct {
+	config BatchConfig
+	flush  func([]T) error
+
+	mu      sync.Mutex
+	pending []T
+	closed  bool
+
+	flushMu sync.Mutex
+	kick    chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewBatcher[T any](config BatchConfig, flush func([]T) error) *Batcher[T] {
+	if config.MaxSize <= 0 {
+		config.MaxSize = 100
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	if config.MaxPending <= 0 {
+		config.MaxPending = config.MaxSize * 10
+	}
+
+	b := &Batcher[T]{
+		config: config,
+		flush:  flush,
+		kick:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.run()
+
+	return b
+}
+
+func (b *Batcher[T]) Add(item T) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+	if len(b.pending) >= b.config.MaxPending {
+		b.mu.Unlock()
+		return ErrBatcherFull
+	}
+	b.pending = append(b.pending, item)
+	full := len(b.pending) >= b.config.MaxSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush synchronously sends everything pending.
+func (b *Batcher[T]) Flush() error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	var errs []error
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 {
+			b.mu.Unlock()
+			return errors.Join(errs...)
+		}
+		n := min(len(b.pending), b.config.MaxSize)
+		batch := b.pending[:n:n]
+		b.pending = b.pending[n:]
+		b.mu.Unlock()
+
+		if err := b.flush(batch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
+
+func (b *Batcher[T]) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.done)
+	b.wg.Wait()
+	return b.Flush()
+}
+
+func (b *Batcher[T]) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		case <-b.kick:
+		}
+
+		if err := b.Flush(); err != nil && b.config.OnError != nil {
+			b.config.OnError(err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type SinkStats struct {
+	Name        string
+	Successes   int64
+	Failures    int64
+	LastError   string
+	LastErrorAt time.Time
+}
+
+type SinkCounters struct {
+	name      string
+	successes atomic.Int64
+	failures  atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+var sinkRegistry = struct {
+	mu       sync.Mutex
+	counters map[string]*SinkCounters
+}{counters: make(map[string]*SinkCounters)}
+
+// RegisterSinkCounters returns the counters for name, creating them on first use.
+func RegisterSinkCounters(name string) *SinkCounters {
+	sinkRegistry.mu.Lock()
+	defer sinkRegistry.mu.Unlock()
+
+	if counters, ok := sinkRegistry.counters[name]; ok {
+		return counters
+	}
+	counters := &SinkCounters{name: name}
+	sinkRegistry.counters[name] = counters
+	return counters
+}
+
+func (c *SinkCounters) Success(n int) {
+	c.successes.Add(int64(n))
+}
+
+func (c *SinkCounters) Failure(n int, err error) {
+	c.failures.Add(int64(n))
+	if err == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.lastError = err.Error()
+	c.lastErrorAt = time.Now()
+	c.mu.Unlock()
+}
+
+func (c *SinkCounters) Stats() SinkStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return SinkStats{
+		Name:        c.name,
+		Successes:   c.successes.Load(),
+		Failures:    c.failures.Load(),
+		LastError:   c.lastError,
+		LastErrorAt: c.lastErrorAt,
+	}
+}
+
+func AllSinkStats() []SinkStats {
+	sinkRegistry.mu.Lock()
+	defer sinkRegistry.mu.Unlock()
+
+	stats := make([]SinkStats, 0, len(sinkRegistry.counters))
+	for _, counters := range sinkRegistry.counters {
+		stats = append(stats, counters.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
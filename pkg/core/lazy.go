@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// lazyValue defers an expensive attribute until a handler resolves it.
+// slog.Logger checks Enabled before attrs are touched and hooks leave
+// lazy values unresolved, so fn only runs for records that are written,
+// and sync.Once keeps it to one call however many sinks read it.
+type lazyValue struct {
+	once  sync.Once
+	fn    func() slog.Value
+	value slog.Value
+}
+
+func (l *lazyValue) LogValue() slog.Value {
+	l.once.Do(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				l.value = slog.StringValue(fmt.Sprintf("!PANIC: %v", r))
+			}
+		}()
+		l.value = l.fn()
+	})
+	return l.value
+}
+
+func Lazy(key string, fn func() any) slog.Attr {
+	return slog.Any(key, &lazyValue{fn: func() slog.Value {
+		return slog.AnyValue(fn()).Resolve()
+	}})
+}
+
+func LazyGroup(key string, fn func() []slog.Attr) slog.Attr {
+	return slog.Any(key, &lazyValue{fn: func() slog.Value {
+		return slog.GroupValue(fn()...)
+	}})
+}
+
+// LazyValue wraps an already lazy value so transform runs on its result,
+// still at most once and only when resolved.
+func LazyValue(value slog.Value, transform func(slog.Value) slog.Value) slog.Value {
+	return slog.AnyValue(&lazyValue{fn: func() slog.Value {
+		return transform(value.Resolve())
+	}})
+}
@@ -1,11 +1,37 @@
 package core
 
 import (
+	"context"
 	"log/slog"
 )
 
 var TraceIDKey = "trace_id"
 
+type loggerCtxKey struct{}
+
+// ContextWithLogger stores logger in ctx, rmlog.FromContext and integrations
+// that cannot import rmlog read it back with LoggerFromContext.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+func LoggerFromContext(ctx context.Context) (*slog.Logger, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	logger, ok := ctx.Value(loggerCtxKey{}).(*slog.Logger)
+	return logger, ok
+}
+
+// LoggerInfo describes a named logger, see rmlog.Loggers.
+type LoggerInfo struct {
+	Name string `json:"name"`
+	// Level is empty when the logger follows the level of Log.
+	Level string `json:"level,omitempty"`
+	// InheritedFrom names the ancestor Level was set on.
+	InheritedFrom string `json:"inherited_from,omitempty"`
+}
+
 type LoggerConfig struct {
 	AddSource    bool
 	Level        slog.Level
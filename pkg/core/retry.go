@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter is the random fraction of the delay added or removed, 0..1.
+	Jitter     float64
+	MaxRetries int
+}
+
+var DefaultBackoff = Backoff{
+	Initial:    500 * time.Millisecond,
+	Max:        30 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+	MaxRetries: 5,
+}
+
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Initial <= 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// RetryDelay is the wait before retry attempt+1, a server's Retry-After
+// is honored up to Max (DefaultBackoff.Max when unset) so one response
+// cannot park a sink for hours.
+func (b Backoff) RetryDelay(attempt int, after time.Duration) time.Duration {
+	limit := b.Max
+	if limit <= 0 {
+		limit = DefaultBackoff.Max
+	}
+	return max(b.Delay(attempt), min(after, limit))
+}
+
+type RetryableError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retry calls fn until it succeeds, returns a non-retryable error or
+// MaxRetries is exhausted. Only *RetryableError results are retried, ctx
+// only cuts the waits short, fn always runs at least once.
+func Retry(ctx context.Context, b Backoff, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var retryable *RetryableError
+		if !errors.As(err, &retryable) || attempt >= b.MaxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(b.RetryDelay(attempt, retryable.After))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// CheckHTTPResponse turns a non-2xx response into an error, 429 and 5xx
+// responses are marked retryable and honor Retry-After.
+func CheckHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &RetryableError{Err: err, After: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return err
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
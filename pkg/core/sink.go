@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+type Entry struct {
+	Time     time.Time
+	Level    slog.Level
+	Message  string
+	File     string
+	Line     int
+	Function string
+	TraceID  string
+	Attrs    []slog.Attr
+}
+
+type Sink interface {
+	Write(ctx context.Context, entry Entry) error
+	Close() error
+}
+
+func NewEntry(ctx context.Context, r slog.Record, attrs []slog.Attr) Entry {
+	entry := Entry{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		TraceID: GetTraceID(ctx),
+		Attrs:   attrs,
+	}
+
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		entry.File = frame.File
+		entry.Line = frame.Line
+		entry.Function = frame.Function
+	}
+
+	return entry
+}
+
+// FlattenAttrs expands groups into dot-separated keys.
+func FlattenAttrs(attrs []slog.Attr) []slog.Attr {
+	flat := make([]slog.Attr, 0, len(attrs))
+	var walk func(prefix string, attrs []slog.Attr)
+	walk = func(prefix string, attrs []slog.Attr) {
+		for _, attr := range attrs {
+			value := attr.Value.Resolve()
+			key := attr.Key
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if value.Kind() == slog.KindGroup {
+				walk(key, value.Group())
+				continue
+			}
+			flat = append(flat, slog.Attr{Key: key, Value: value})
+		}
+	}
+	walk("", attrs)
+	return flat
+}
+
+// EntryToMap renders an entry as a JSON friendly map, groups become nested maps.
+func EntryToMap(entry Entry) map[string]any {
+	m := map[string]any{
+		"time":    entry.Time.Format(time.RFC3339Nano),
+		"level":   entry.Level.String(),
+		"message": entry.Message,
+	}
+	if entry.TraceID != "" {
+		m[TraceIDKey] = entry.TraceID
+	}
+	if entry.File != "" {
+		m["source"] = fmt.Sprintf("%s:%d", entry.File, entry.Line)
+	}
+	for _, attr := range entry.Attrs {
+		if _, reserved := m[attr.Key]; reserved {
+			continue
+		}
+		m[attr.Key] = ValueToAny(attr.Value)
+	}
+	return m
+}
+
+func ValueToAny(value slog.Value) any {
+	value = value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := make(map[string]any, len(value.Group()))
+		for _, attr := range value.Group() {
+			group[attr.Key] = ValueToAny(attr.Value)
+		}
+		return group
+	case slog.KindDuration:
+		return value.Duration().String()
+	case slog.KindTime:
+		return value.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return err.Error()
+		}
+		return value.Any()
+	default:
+		return value.Any()
+	}
+}
+
+type recentRecordsCtxKey struct{}
+
+// WithRecentRecords attaches records that preceded the one being logged,
+// sinks that support it (Sentry breadcrumbs, alerts) include them.
+func WithRecentRecords(ctx context.Context, records []slog.Record) context.Context {
+	if len(records) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, recentRecordsCtxKey{}, records)
+}
+
+func RecentRecords(ctx context.Context) []slog.Record {
+	if ctx == nil {
+		return nil
+	}
+	records, _ := ctx.Value(recentRecordsCtxKey{}).([]slog.Record)
+	return records
+}
+
+// SinkName returns Name() when the sink provides it, otherwise its package name.
+func SinkName(sink Sink) string {
+	if named, ok := sink.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	t := reflect.TypeOf(sink)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if pkg := t.PkgPath(); pkg != "" {
+		return path.Base(pkg)
+	}
+	return t.String()
+}
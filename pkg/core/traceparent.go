@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceParent is a W3C trace context, see https://www.w3.org/TR/trace-context/.
+type TraceParent struct {
+	TraceID string
+	SpanID  string
+	Flags   byte
+}
+
+type traceParentCtxKey struct{}
+
+func ParseTraceParent(s string) (TraceParent, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return TraceParent{}, false
+	}
+	if !isHexID(parts[1], 32) || !isHexID(parts[2], 16) || len(parts[3]) != 2 {
+		return TraceParent{}, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return TraceParent{}, false
+	}
+
+	return TraceParent{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Flags:   flags[0],
+	}, true
+}
+
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.TraceID, tp.SpanID, tp.Flags)
+}
+
+func ContextWithTraceParent(ctx context.Context, tp TraceParent) context.Context {
+	return context.WithValue(ctx, traceParentCtxKey{}, tp)
+}
+
+func TraceParentFromContext(ctx context.Context) (TraceParent, bool) {
+	if ctx == nil {
+		return TraceParent{}, false
+	}
+	tp, ok := ctx.Value(traceParentCtxKey{}).(TraceParent)
+	return tp, ok
+}
+
+// TraceIDToHex converts a trace ID produced by this package (a UUID) or a
+// 32 char hex string into the 16 byte hex form used by W3C and OTLP.
+func TraceIDToHex(traceID string) string {
+	id := strings.ToLower(strings.ReplaceAll(traceID, "-", ""))
+	if !isHexID(id, 32) {
+		return ""
+	}
+	return id
+}
+
+func isHexID(s string, length int) bool {
+	if len(s) != length || strings.Trim(s, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
@@ -116,3 +117,32 @@ func GetLinePositionStringWithSkip(skip int) string {
 func GetBoolFromStr(s string) bool {
 	return strings.ToLower(s) == "true"
 }
+
+// TruncateString cuts s to at most max bytes on a rune boundary, the
+// "…[truncated N bytes]" marker counts towards max.
+func TruncateString(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+
+	cut := max
+	marker := ""
+	for {
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		marker = fmt.Sprintf("…[truncated %d bytes]", len(s)-cut)
+		if cut+len(marker) <= max {
+			break
+		}
+		if len(marker) >= max {
+			cut = max
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+			return s[:cut]
+		}
+		cut = max - len(marker)
+	}
+	return s[:cut] + marker
+}
@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const FilterHookName = "filter"
+
+type filterField int
+
+const (
+	fieldLevel filterField = iota
+	fieldMessage
+	fieldSource
+	fieldAttr
+)
+
+type filterCond struct {
+	field  filterField
+	key    string
+	op     string
+	value  string
+	level  slog.Level
+	number float64
+	re     *regexp.Regexp
+}
+
+type filterRule struct {
+	expr  string
+	conds []filterCond
+	hits  atomic.Int64
+}
+
+// Filter drops records matching any of its rules. Rules look like
+//
+//	drop if route=/healthz and level<warn
+//	drop if source^=github.com/chatty/lib and level<=debug
+//	drop if msg~="^cache (hit|miss)"
+//
+// Fields are level, msg, source (function of the call site) or an attribute
+// key; operators are =, !=, ^= (prefix), ~= (regexp), <, <=, >, >=.
+type Filter struct {
+	rules      []*filterRule
+	needSource bool
+	attrKeys   map[string]bool
+	// groupKeys holds the group prefixes of attrKeys, other attrs are never
+	// resolved so lazy values stay unevaluated for dropped records.
+	groupKeys map[string]bool
+}
+
+var condPattern = regexp.MustCompile(`^([A-Za-z0-9_.\-]+)\s*(!=|\^=|~=|<=|>=|=|<|>)\s*(.*)$`)
+
+func CompileFilter(rules ...string) (*Filter, error) {
+	f := &Filter{attrKeys: make(map[string]bool), groupKeys: make(map[string]bool)}
+
+	for _, expr := range rules {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		rule, err := compileRule(expr)
+		if err != nil {
+			return nil, err
+		}
+		for _, cond := range rule.conds {
+			switch cond.field {
+			case fieldSource:
+				f.needSource = true
+			case fieldAttr:
+				f.attrKeys[cond.key] = true
+				for i := strings.IndexByte(cond.key, '.'); i > 0; i = nextDot(cond.key, i) {
+					f.groupKeys[cond.key[:i]] = true
+				}
+			}
+		}
+		f.rules = append(f.rules, rule)
+	}
+
+	return f, nil
+}
+
+// FilterFromEnv compiles ";" separated rules from the environment variable key.
+func FilterFromEnv(key string) (*Filter, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := CompileFilter(strings.Split(value, ";")...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return f, nil
+}
+
+func nextDot(s string, i int) int {
+	if j := strings.IndexByte(s[i+1:], '.'); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
+
+func compileRule(expr string) (*filterRule, error) {
+	body, ok := strings.CutPrefix(expr, "drop if ")
+	if !ok {
+		return nil, fmt.Errorf("filter rule %q: must start with \"drop if\"", expr)
+	}
+
+	rule := &filterRule{expr: expr}
+	for _, part := range splitConditions(body) {
+		cond, err := compileCond(part)
+		if err != nil {
+			return nil, fmt.Errorf("filter rule %q: %w", expr, err)
+		}
+		rule.conds = append(rule.conds, cond)
+	}
+	if len(rule.conds) == 0 {
+		return nil, fmt.Errorf("filter rule %q: no conditions", expr)
+	}
+
+	// Cheap checks first so most records are rejected without attr lookups.
+	sortConds(rule.conds)
+	return rule, nil
+}
+
+// splitConditions splits body on "and" outside double quotes, quoted values
+// keep their exact spacing.
+func splitConditions(body string) []string {
+	var parts []string
+	start := 0
+	inQuotes := false
+
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case inQuotes && c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && isSpace(c) && isAndSeparator(body[i+1:]):
+			if part := strings.TrimSpace(body[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1 + len("and")
+			i = start - 1
+		}
+	}
+	if part := strings.TrimSpace(body[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// isAndSeparator reports whether s starts with a standalone "and".
+func isAndSeparator(s string) bool {
+	return len(s) > len("and") && strings.EqualFold(s[:3], "and") && isSpace(s[3])
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func compileCond(s string) (filterCond, error) {
+	m := condPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return filterCond{}, fmt.Errorf("invalid condition %q", s)
+	}
+
+	cond := filterCond{key: m[1], op: m[2], value: m[3]}
+	if unquoted, err := strconv.Unquote(cond.value); err == nil {
+		cond.value = unquoted
+	}
+
+	switch cond.key {
+	case "level":
+		cond.field = fieldLevel
+		if err := cond.level.UnmarshalText([]byte(cond.value)); err != nil {
+			return filterCond{}, fmt.Errorf("invalid level %q", cond.value)
+		}
+		if cond.op == "^=" || cond.op == "~=" {
+			return filterCond{}, fmt.Errorf("operator %s is not supported for level", cond.op)
+		}
+		return cond, nil
+	case "msg", "message":
+		cond.field = fieldMessage
+	case "source":
+		cond.field = fieldSource
+	default:
+		cond.field = fieldAttr
+	}
+
+	switch cond.op {
+	case "~=":
+		re, err := regexp.Compile(cond.value)
+		if err != nil {
+			return filterCond{}, fmt.Errorf("invalid regexp %q: %w", cond.value, err)
+		}
+		cond.re = re
+	case "<", "<=", ">", ">=":
+		n, err := strconv.ParseFloat(cond.value, 64)
+		if err != nil {
+			return filterCond{}, fmt.Errorf("operator %s needs a number, got %q", cond.op, cond.value)
+		}
+		cond.number = n
+	}
+
+	return cond, nil
+}
+
+func sortConds(conds []filterCond) {
+	for i := 1; i < len(conds); i++ {
+		for j := i; j > 0 && conds[j].field < conds[j-1].field; j-- {
+			conds[j], conds[j-1] = conds[j-1], conds[j]
+		}
+	}
+}
+
+// Match returns the index of the first matching rule.
+func (f *Filter) Match(r slog.Record) (int, bool) {
+	if f == nil || len(f.rules) == 0 {
+		return -1, false
+	}
+
+	var source string
+	var attrs map[string]string
+	lookup := func(cond filterCond) (string, bool) {
+		switch cond.field {
+		case fieldMessage:
+			return r.Message, true
+		case fieldSource:
+			if source == "" && f.needSource && r.PC != 0 {
+				frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+				source = frame.Function
+			}
+			return source, source != ""
+		default:
+			if attrs == nil {
+				attrs = f.collectAttrs(r)
+			}
+			value, ok := attrs[cond.key]
+			return value, ok
+		}
+	}
+
+	for i, rule := range f.rules {
+		if rule.matches(r.Level, lookup) {
+			rule.hits.Add(1)
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (rule *filterRule) matches(level slog.Level, lookup func(filterCond) (string, bool)) bool {
+	for _, cond := range rule.conds {
+		if cond.field == fieldLevel {
+			if !compareLevel(level, cond.op, cond.level) {
+				return false
+			}
+			continue
+		}
+
+		value, ok := lookup(cond)
+		if !ok {
+			if cond.op != "!=" {
+				return false
+			}
+			continue
+		}
+		if !cond.matchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond filterCond) matchString(value string) bool {
+	switch cond.op {
+	case "=":
+		return value == cond.value
+	case "!=":
+		return value != cond.value
+	case "^=":
+		return strings.HasPrefix(value, cond.value)
+	case "~=":
+		return cond.re.MatchString(value)
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+	switch cond.op {
+	case "<":
+		return n < cond.number
+	case "<=":
+		return n <= cond.number
+	case ">":
+		return n > cond.number
+	default:
+		return n >= cond.number
+	}
+}
+
+func compareLevel(level slog.Level, op string, target slog.Level) bool {
+	switch op {
+	case "=":
+		return level == target
+	case "!=":
+		return level != target
+	case "<":
+		return level < target
+	case "<=":
+		return level <= target
+	case ">":
+		return level > target
+	default:
+		return level >= target
+	}
+}
+
+func (f *Filter) collectAttrs(r slog.Record) map[string]string {
+	attrs := make(map[string]string, len(f.attrKeys))
+	var walk func(prefix string, a slog.Attr)
+	walk = func(prefix string, a slog.Attr) {
+		key := a.Key
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if !f.attrKeys[key] && !f.groupKeys[key] {
+			return
+		}
+		value := a.Value.Resolve()
+		if value.Kind() == slog.KindGroup {
+			for _, child := range value.Group() {
+				walk(key, child)
+			}
+			return
+		}
+		if f.attrKeys[key] {
+			attrs[key] = value.String()
+		}
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		walk("", a)
+		return true
+	})
+	return attrs
+}
+
+// Hits returns how many records each rule dropped, keyed by rule text.
+func (f *Filter) Hits() map[string]int64 {
+	hits := make(map[string]int64, len(f.rules))
+	for _, rule := range f.rules {
+		hits[rule.expr] = rule.hits.Load()
+	}
+	return hits
+}
+
+func (f *Filter) Hook() Hook {
+	return Hook{
+		Name: FilterHookName,
+		BeforeHandle: func(ctx context.Context, r *slog.Record) bool {
+			_, matched := f.Match(*r)
+			return !matched
+		},
+	}
+}
+
+// SetFilter installs f as the first hook so it applies before stdout, sinks and Sentry.
+func (h *CustomHandler) SetFilter(f *Filter) *CustomHandler {
+	h.hooks.update(func(current []Hook) []Hook {
+		current = removeHook(current, FilterHookName)
+		if f != nil {
+			current = append([]Hook{f.Hook()}, current...)
+		}
+		return current
+	})
+	return h
+}
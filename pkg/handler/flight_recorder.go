@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type FlightRecorderConfig struct {
+	// Size is the ring buffer capacity, records of every level are kept here.
+	Size int
+	// DumpCount is how many preceding records are dumped on trigger, 0 means whole buffer.
+	DumpCount int
+	// DumpLevel triggers an automatic dump, defaults to slog.LevelError.
+	DumpLevel *slog.Level
+	// SameTraceOnly restricts a dump to records with the trigger's trace ID,
+	// a trigger without trace ID dumps regardless of trace.
+	SameTraceOnly bool
+}
+
+type flightEntry struct {
+	record  slog.Record
+	traceID string
+	written bool
+	dumped  bool
+}
+
+type flightRing struct {
+	mu      sync.Mutex
+	entries []flightEntry
+	next    int
+	full    bool
+}
+
+func (rb *flightRing) push(e flightEntry) {
+	rb.mu.Lock()
+	rb.entries[rb.next] = e
+	rb.next++
+	if rb.next == len(rb.entries) {
+		rb.next = 0
+		rb.full = true
+	}
+	rb.mu.Unlock()
+}
+
+// collect returns up to count entries in chronological order and marks them dumped.
+func (rb *flightRing) collect(count int, traceID string, sameTraceOnly bool) []flightEntry {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	size := rb.next
+	if rb.full {
+		size = len(rb.entries)
+	}
+	if count <= 0 || count > size {
+		count = size
+	}
+
+	result := make([]flightEntry, 0, count)
+	for i := 1; i <= size && len(result) < count; i++ {
+		idx := (rb.next - i + len(rb.entries)) % len(rb.entries)
+		entry := &rb.entries[idx]
+		if sameTraceOnly && traceID != "" && entry.traceID != traceID {
+			continue
+		}
+		result = append(result, *entry)
+		entry.dumped = true
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+type levelCheckedKey struct{}
+
+// ContextWithLevelChecked tells FlightRecorder that the caller already
+// decided the record should be written, e.g. a named logger with a level
+// below the handler's.
+func ContextWithLevelChecked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, levelCheckedKey{}, true)
+}
+
+func levelChecked(ctx context.Context) bool {
+	checked, _ := ctx.Value(levelCheckedKey{}).(bool)
+	return checked
+}
+
+type FlightRecorder struct {
+	inner     *CustomHandler
+	ring      *flightRing
+	config    FlightRecorderConfig
+	dumpLevel slog.Level
+}
+
+func NewFlightRecorder(inner *CustomHandler, config FlightRecorderConfig) *FlightRecorder {
+	if config.Size <= 0 {
+		config.Size = 256
+	}
+
+	dumpLevel := slog.LevelError
+	if config.DumpLevel != nil {
+		dumpLevel = *config.DumpLevel
+	}
+
+	return &FlightRecorder{
+		inner:     inner,
+		ring:      &flightRing{entries: make([]flightEntry, config.Size)},
+		config:    config,
+		dumpLevel: dumpLevel,
+	}
+}
+
+func (f *FlightRecorder) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+func (f *FlightRecorder) Handle(ctx context.Context, r slog.Record) error {
+	traceID := core.GetTraceID(ctx)
+	written := levelChecked(ctx) || f.inner.Enabled(ctx, r.Level)
+
+	buffered := r
+	if len(f.inner.goas) > 0 {
+		buffered = f.inner.applyGroupOrAttrs(r)
+	}
+
+	if r.Level >= f.dumpLevel {
+		preceding := f.ring.collect(f.config.DumpCount, traceID, f.config.SameTraceOnly)
+		f.push(buffered, traceID, written)
+
+		// A failed dump must not cost the trigger record itself.
+		dumpErr := f.writeSuppressed(ctx, preceding)
+
+		records := make([]slog.Record, 0, len(preceding))
+		for _, entry := range preceding {
+			records = append(records, entry.record)
+		}
+		ctx = core.WithRecentRecords(ctx, records)
+
+		if !written {
+			return dumpErr
+		}
+		return errors.Join(dumpErr, f.inner.Handle(ctx, r))
+	}
+
+	f.push(buffered, traceID, written)
+	if !written {
+		return nil
+	}
+	return f.inner.Handle(ctx, r)
+}
+
+func (f *FlightRecorder) push(r slog.Record, traceID string, written bool) {
+	f.ring.push(flightEntry{
+		record:  r.Clone(),
+		traceID: traceID,
+		written: written,
+	})
+}
+
+// Dump writes buffered records that were suppressed by the level filter.
+// An empty traceID dumps records regardless of trace.
+func (f *FlightRecorder) Dump(traceID string) error {
+	return f.writeSuppressed(context.Background(), f.ring.collect(f.config.DumpCount, traceID, traceID != ""))
+}
+
+// Records returns buffered records without marking them dumped.
+func (f *FlightRecorder) Records(traceID string) []slog.Record {
+	f.ring.mu.Lock()
+	defer f.ring.mu.Unlock()
+
+	var records []slog.Record
+	for i := 0; i < len(f.ring.entries); i++ {
+		idx := i
+		if f.ring.full {
+			idx = (f.ring.next + i) % len(f.ring.entries)
+		} else if i >= f.ring.next {
+			break
+		}
+		entry := f.ring.entries[idx]
+		if traceID != "" && entry.traceID != traceID {
+			continue
+		}
+		records = append(records, entry.record.Clone())
+	}
+	return records
+}
+
+// writeSuppressed sends dumped records through the same hooks, output and
+// sinks as written ones, tagged with flight_recorder=true.
+func (f *FlightRecorder) writeSuppressed(ctx context.Context, entries []flightEntry) error {
+	var errs []error
+	for _, entry := range entries {
+		if entry.written || entry.dumped {
+			continue
+		}
+
+		entryCtx := ctx
+		if entry.traceID != core.GetTraceID(ctx) {
+			entryCtx = context.WithValue(context.Background(), core.TraceIDKey, entry.traceID)
+		}
+
+		r := entry.record.Clone()
+		r.AddAttrs(slog.Bool("flight_recorder", true))
+		if err := f.inner.handle(entryCtx, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs and WithGroup share the ring buffer with f.
+func (f *FlightRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *f
+	clone.inner = f.inner.WithAttrs(attrs).(*CustomHandler)
+	return &clone
+}
+
+func (f *FlightRecorder) WithGroup(name string) slog.Handler {
+	clone := *f
+	clone.inner = f.inner.WithGroup(name).(*CustomHandler)
+	return &clone
+}
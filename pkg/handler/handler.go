@@ -2,32 +2,115 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
-	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmsentry"
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/metrics"
 )
 
-var Log = slog.New(NewCustomHandler(os.Stdout, slog.LevelError, false, false))
+var Log = slog.New(NewCustomHandler(os.Stdout, slog.LevelError, false, false).SetName("internal"))
+
+type Format int
+
+const (
+	FormatText Format = iota
+	FormatJSON
+)
+
+type SourceMode int
+
+const (
+	SourceNone SourceMode = iota
+	SourceFull
+	SourceShort
+)
 
 type CustomHandler struct {
-	writer       io.Writer
-	addSource    bool
-	level        slog.Level
-	enableSentry bool
+	writer     io.Writer
+	sourceMode SourceMode
+	format     Format
+	level      slog.Level
+	schema     *Schema
+	limits     *Limits
+	sinks      []core.Sink
+	hooks      *hookPipeline
+	name       string
+	goas       []groupOrAttrs
+}
+
+// groupOrAttrs records a WithGroup or WithAttrs call, in call order.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
 }
 
 func NewCustomHandler(w io.Writer, level slog.Level, addSource, enableSentry bool) *CustomHandler {
-	return &CustomHandler{
-		writer:       w,
-		level:        level,
-		addSource:    addSource,
-		enableSentry: enableSentry,
+	h := &CustomHandler{
+		writer: w,
+		level:  level,
+		name:   "default",
+		hooks:  &hookPipeline{},
+	}
+	if addSource == true {
+		h.sourceMode = SourceFull
+	}
+	if enableSentry == true {
+		h.AddHook(SentryHook())
+	}
+	return h
+}
+
+func (h *CustomHandler) SetName(name string) *CustomHandler {
+	h.name = name
+	return h
+}
+
+func (h *CustomHandler) SetFormat(format Format) *CustomHandler {
+	h.format = format
+	return h
+}
+
+func (h *CustomHandler) SetSourceMode(mode SourceMode) *CustomHandler {
+	h.sourceMode = mode
+	return h
+}
+
+func (h *CustomHandler) SetSchema(schema *Schema) *CustomHandler {
+	h.schema = schema
+	return h
+}
+
+func (h *CustomHandler) SetLimits(limits *Limits) *CustomHandler {
+	h.limits = limits
+	return h
+}
+
+func (h *CustomHandler) AddSink(sinks ...core.Sink) *CustomHandler {
+	h.sinks = append(h.sinks, sinks...)
+	return h
+}
+
+type loggerNameKey struct{}
+
+// ContextWithLoggerName makes RecordsTotal count records handled with ctx
+// under name instead of the handler's name, e.g. a named logger's.
+func ContextWithLoggerName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, loggerNameKey{}, name)
+}
+
+func loggerName(ctx context.Context, fallback string) string {
+	if name, ok := ctx.Value(loggerNameKey{}).(string); ok && name != "" {
+		return name
 	}
+	return fallback
 }
 
 func (h *CustomHandler) Enabled(ctx context.Context, level slog.Level) bool {
@@ -35,22 +118,150 @@ func (h *CustomHandler) Enabled(ctx context.Context, level slog.Level) bool {
 }
 
 func (h *CustomHandler) Handle(ctx context.Context, r slog.Record) error {
+	if len(h.goas) > 0 {
+		r = h.applyGroupOrAttrs(r)
+	}
+	return h.handle(ctx, r)
+}
+
+// handle runs hooks, writes and fans out a record whose WithAttrs/WithGroup
+// state is already applied.
+func (h *CustomHandler) handle(ctx context.Context, r slog.Record) error {
+	if droppedBy, ok := h.runBeforeHooks(ctx, &r); !ok {
+		metrics.RecordsDropped.Inc(droppedBy)
+		return nil
+	}
+
+	metrics.RecordsTotal.Inc(r.Level.String(), loggerName(ctx, h.name))
+	r.Message = h.limits.applyMessage(r.Message)
+	slogAttrs := h.collectAttrs(r)
+
+	writeErr := h.writeRecord(r, slogAttrs)
+	sinkErr := h.writeSinks(ctx, r, slogAttrs)
+
+	h.runAfterHooks(ctx, r, slogAttrs, writeErr)
+
+	return errors.Join(writeErr, sinkErr)
+}
+
+func (h *CustomHandler) writeSinks(ctx context.Context, r slog.Record, slogAttrs []slog.Attr) error {
+	if len(h.sinks) == 0 {
+		return nil
+	}
+
+	entry := core.NewEntry(ctx, r, slogAttrs)
+
+	var errs []error
+	for _, sink := range h.sinks {
+		name := core.SinkName(sink)
+		start := time.Now()
+		err := sink.Write(ctx, entry)
+		metrics.SinkWriteSeconds.Observe(time.Since(start).Seconds(), name)
+		if err != nil {
+			metrics.SinkErrors.Inc(name)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *CustomHandler) Close() error {
+	var errs []error
+	for _, sink := range h.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *CustomHandler) collectAttrs(r slog.Record) []slog.Attr {
+	slogAttrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(attr slog.Attr) bool {
+		if attr, ok := resolveAttr(attr); ok {
+			slogAttrs = append(slogAttrs, attr)
+		}
+		return true
+	})
+
+	if h.schema == nil {
+		return h.limits.applyAttrs(slogAttrs)
+	}
+
+	slogAttrs, violations := h.schema.Apply(slogAttrs)
+	for _, v := range violations {
+		if !h.schema.shouldWarn(v.Key, r.Time) {
+			continue
+		}
+		warning := slog.NewRecord(r.Time, slog.LevelWarn, "Schema violation", r.PC)
+		h.writeRecord(warning, []slog.Attr{
+			slog.String("key", v.Key),
+			slog.String("expected", v.Expected.String()),
+			slog.String("got", v.Got.String()),
+			slog.Bool("dropped", v.Dropped),
+		})
+	}
+
+	return h.limits.applyAttrs(slogAttrs)
+}
+
+// resolveAttr resolves LogValuers once per record and reports false for
+// attrs that resolve to an empty group, which slog handlers omit.
+func resolveAttr(attr slog.Attr) (slog.Attr, bool) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() != slog.KindGroup {
+		return attr, true
+	}
+
+	group := make([]slog.Attr, 0, len(attr.Value.Group()))
+	for _, a := range attr.Value.Group() {
+		if a, ok := resolveAttr(a); ok {
+			group = append(group, a)
+		}
+	}
+	if len(group) == 0 {
+		return attr, false
+	}
+	attr.Value = slog.GroupValue(group...)
+	return attr, true
+}
+
+func (h *CustomHandler) writeRecord(r slog.Record, slogAttrs []slog.Attr) error {
+	var file string
+	var line int
+	// Like slog, a record without PC has no source, guessing a caller
+	// depth would point into whatever wrapper handler sits in between.
+	if h.sourceMode != SourceNone && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file = frame.File
+		line = frame.Line
+		if h.sourceMode == SourceShort {
+			file = filepath.Base(file)
+		}
+	}
+
+	if h.format == FormatJSON {
+		data, err := h.limits.applyJSON(core.EntryToMap(core.Entry{
+			Time:    r.Time,
+			Level:   r.Level,
+			Message: r.Message,
+			File:    file,
+			Line:    line,
+			Attrs:   slogAttrs,
+		}), slogAttrs)
+		if err == nil {
+			_, err = fmt.Fprintln(h.writer, string(data))
+			return err
+		}
+	}
+
 	timestamp := r.Time.Format("2006/01/02 15:04:05")
 
 	level := fmt.Sprintf("[%s]", strings.ToUpper(r.Level.String()))
 
 	var parts []string
 
-	if h.addSource == true {
-		var file string
-		var line int
-		if r.PC != 0 {
-			frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
-			file = frame.File
-			line = frame.Line
-		} else {
-			_, file, line, _ = runtime.Caller(3)
-		}
+	if file != "" {
 		source := fmt.Sprintf("[%s:%d]", file, line)
 
 		parts = append(parts, timestamp, level, source, r.Message)
@@ -59,38 +270,61 @@ func (h *CustomHandler) Handle(ctx context.Context, r slog.Record) error {
 	}
 
 	var attrs []string
-	r.Attrs(func(a slog.Attr) bool {
-		attrs = append(attrs, fmt.Sprintf("%s=%s", a.Key, a.Value.String()))
-		return true
-	})
-
-	var slogAttrs []slog.Attr
-	r.Attrs(func(attr slog.Attr) bool {
-		slogAttrs = append(slogAttrs, attr)
-		return true
-	})
+	for _, a := range slogAttrs {
+		attrs = append(attrs, fmt.Sprintf("%s=%s", a.Key, a.Value.Resolve().String()))
+	}
 
 	logLine := strings.Join(parts, " ")
 	if len(attrs) > 0 {
 		logLine += " " + strings.Join(attrs, " ")
 	}
 
-	_, err := fmt.Fprintln(h.writer, logLine)
-	if err != nil {
-		return err
-	}
+	_, err := fmt.Fprintln(h.writer, h.limits.applyLine(logLine))
+	return err
+}
 
-	if h.enableSentry == true {
-		rmsentry.CaptureEvent(ctx, r, slogAttrs)
+// applyGroupOrAttrs folds attrs and groups from WithAttrs/WithGroup into r
+// so hooks and sinks see one flat list of record attrs.
+func (h *CustomHandler) applyGroupOrAttrs(r slog.Record) slog.Record {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	for i := len(h.goas) - 1; i >= 0; i-- {
+		goa := h.goas[i]
+		if goa.group == "" {
+			attrs = append(append(make([]slog.Attr, 0, len(goa.attrs)+len(attrs)), goa.attrs...), attrs...)
+			continue
+		}
+		if len(attrs) > 0 {
+			attrs = []slog.Attr{{Key: goa.group, Value: slog.GroupValue(attrs...)}}
+		}
 	}
 
-	return nil
+	record := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	record.AddAttrs(attrs...)
+	return record
+}
+
+func (h *CustomHandler) withGroupOrAttrs(goa groupOrAttrs) *CustomHandler {
+	clone := *h
+	clone.goas = append(make([]groupOrAttrs, 0, len(h.goas)+1), h.goas...)
+	clone.goas = append(clone.goas, goa)
+	return &clone
 }
 
 func (h *CustomHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return h
+	if len(attrs) == 0 {
+		return h
+	}
+	return h.withGroupOrAttrs(groupOrAttrs{attrs: attrs})
 }
 
 func (h *CustomHandler) WithGroup(name string) slog.Handler {
-	return h
+	if name == "" {
+		return h
+	}
+	return h.withGroupOrAttrs(groupOrAttrs{group: name})
 }
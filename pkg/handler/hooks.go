@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmsentry"
+)
+
+const SentryHookName = "sentry"
+
+// Hook extends CustomHandler. BeforeHandle runs before formatting and may
+// mutate the record or return false to drop it. AfterHandle observes the
+// final record, its attributes and the result of writing it to the handler's
+// writer, sink errors are only returned from Handle.
+type Hook struct {
+	Name         string
+	BeforeHandle func(ctx context.Context, r *slog.Record) bool
+	AfterHandle  func(ctx context.Context, r slog.Record, attrs []slog.Attr, err error)
+}
+
+func SentryHook() Hook {
+	return Hook{
+		Name: SentryHookName,
+		AfterHandle: func(ctx context.Context, r slog.Record, attrs []slog.Attr, err error) {
+			if err != nil {
+				return
+			}
+			rmsentry.CaptureEvent(ctx, r, attrs)
+		},
+	}
+}
+
+// hookPipeline is shared by a handler and its WithAttrs/WithGroup clones.
+// Updates copy the slice and swap it in, so Handle reads it without locking.
+type hookPipeline struct {
+	mu    sync.Mutex
+	hooks atomic.Pointer[[]Hook]
+}
+
+func (p *hookPipeline) load() []Hook {
+	if hooks := p.hooks.Load(); hooks != nil {
+		return *hooks
+	}
+	return nil
+}
+
+// update hands fn a copy of the current hooks and installs its result.
+func (p *hookPipeline) update(fn func(hooks []Hook) []Hook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hooks := fn(append([]Hook(nil), p.load()...))
+	p.hooks.Store(&hooks)
+}
+
+func (h *CustomHandler) AddHook(hooks ...Hook) *CustomHandler {
+	h.hooks.update(func(current []Hook) []Hook {
+		return append(current, hooks...)
+	})
+	return h
+}
+
+// SetHooks replaces the whole pipeline, use it to reorder hooks.
+func (h *CustomHandler) SetHooks(hooks ...Hook) *CustomHandler {
+	h.hooks.update(func([]Hook) []Hook {
+		return append([]Hook(nil), hooks...)
+	})
+	return h
+}
+
+func (h *CustomHandler) Hooks() []Hook {
+	return append([]Hook(nil), h.hooks.load()...)
+}
+
+// ReplaceHook swaps the hook with the given name, it reports false when none matched.
+func (h *CustomHandler) ReplaceHook(name string, hook Hook) bool {
+	replaced := false
+	h.hooks.update(func(current []Hook) []Hook {
+		for i := range current {
+			if current[i].Name == name {
+				current[i] = hook
+				replaced = true
+				break
+			}
+		}
+		return current
+	})
+	return replaced
+}
+
+func (h *CustomHandler) RemoveHook(name string) *CustomHandler {
+	h.hooks.update(func(current []Hook) []Hook {
+		return removeHook(current, name)
+	})
+	return h
+}
+
+func removeHook(hooks []Hook, name string) []Hook {
+	kept := hooks[:0]
+	for _, hook := range hooks {
+		if hook.Name != name {
+			kept = append(kept, hook)
+		}
+	}
+	return kept
+}
+
+// runBeforeHooks returns the name of the hook that dropped the record, if any.
+func (h *CustomHandler) runBeforeHooks(ctx context.Context, r *slog.Record) (string, bool) {
+	cloned := false
+	for _, hook := range h.hooks.load() {
+		if hook.BeforeHandle == nil {
+			continue
+		}
+		if !cloned {
+			*r = r.Clone()
+			cloned = true
+		}
+		if !hook.BeforeHandle(ctx, r) {
+			return hook.Name, false
+		}
+	}
+	return "", true
+}
+
+func (h *CustomHandler) runAfterHooks(ctx context.Context, r slog.Record, attrs []slog.Attr, err error) {
+	for _, hook := range h.hooks.load() {
+		if hook.AfterHandle != nil {
+			hook.AfterHandle(ctx, r, attrs, err)
+		}
+	}
+}
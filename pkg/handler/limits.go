@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+// Limits bounds the size of a record, zero disables a limit.
+type Limits struct {
+	MaxMessageLength int
+	MaxValueLength   int
+	MaxAttrs         int
+	MaxRecordBytes   int
+}
+
+func (l *Limits) applyMessage(msg string) string {
+	if l == nil {
+		return msg
+	}
+	return core.TruncateString(msg, l.MaxMessageLength)
+}
+
+func (l *Limits) applyAttrs(attrs []slog.Attr) []slog.Attr {
+	if l == nil {
+		return attrs
+	}
+
+	if l.MaxAttrs > 0 && len(attrs) > l.MaxAttrs {
+		dropped := len(attrs) - l.MaxAttrs
+		attrs = append(attrs[:l.MaxAttrs:l.MaxAttrs], slog.Int("attrs_truncated", dropped))
+	}
+
+	if l.MaxValueLength <= 0 {
+		return attrs
+	}
+
+	for i, attr := range attrs {
+		value := attr.Value.Resolve()
+		switch value.Kind() {
+		case slog.KindString:
+			if len(value.String()) > l.MaxValueLength {
+				attrs[i] = slog.String(attr.Key, core.TruncateString(value.String(), l.MaxValueLength))
+			}
+		case slog.KindAny:
+			if _, isErr := value.Any().(error); isErr {
+				continue
+			}
+			if str := value.String(); len(str) > l.MaxValueLength {
+				attrs[i] = slog.String(attr.Key, core.TruncateString(str, l.MaxValueLength))
+			}
+		case slog.KindGroup:
+			group := append([]slog.Attr(nil), value.Group()...)
+			attrs[i] = slog.Attr{Key: attr.Key, Value: slog.GroupValue(l.applyAttrs(group)...)}
+		}
+	}
+
+	return attrs
+}
+
+func (l *Limits) applyLine(line string) string {
+	if l == nil {
+		return line
+	}
+	return core.TruncateString(line, l.MaxRecordBytes)
+}
+
+// applyJSON encodes a JSON record within MaxRecordBytes. Cutting the encoded
+// line would leave invalid JSON, so attrs are dropped from the end and then
+// the message is shortened until it fits, and record_truncated is set. Time
+// and level always stay, so a tiny limit can still be exceeded.
+func (l *Limits) applyJSON(m map[string]any, attrs []slog.Attr) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil || l == nil || l.MaxRecordBytes <= 0 || len(data) <= l.MaxRecordBytes {
+		return data, err
+	}
+
+	// Attrs sharing a key with these were skipped by EntryToMap.
+	base := map[string]bool{"time": true, "level": true, "message": true, "source": true, core.TraceIDKey: true}
+
+	m["record_truncated"] = true
+	for i := len(attrs) - 1; i >= 0 && len(data) > l.MaxRecordBytes; i-- {
+		if base[attrs[i].Key] {
+			continue
+		}
+		delete(m, attrs[i].Key)
+		if data, err = json.Marshal(m); err != nil {
+			return nil, err
+		}
+	}
+
+	message, _ := m["message"].(string)
+	for len(data) > l.MaxRecordBytes && message != "" {
+		limit := max(len(message)-(len(data)-l.MaxRecordBytes), 0)
+		if shorter := core.TruncateString(message, limit); len(shorter) < len(message) {
+			message = shorter
+		} else {
+			message = ""
+		}
+		m["message"] = message
+		if data, err = json.Marshal(m); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/metrics"
+)
+
+const RedactHookName = "redact"
+
+const DefaultRedactReplacement = "[REDACTED]"
+
+// RedactHook replaces values of the given attribute keys, matched
+// case-insensitively and at any group depth.
+func RedactHook(keys []string, replacement string) Hook {
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	redacted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		redacted[strings.ToLower(key)] = true
+	}
+
+	var redact func(attrs []slog.Attr) ([]slog.Attr, int, bool)
+	redact = func(attrs []slog.Attr) ([]slog.Attr, int, bool) {
+		count := 0
+		changed := false
+		result := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			switch {
+			case redacted[strings.ToLower(attr.Key)]:
+				result[i] = slog.String(attr.Key, replacement)
+				count++
+			case attr.Value.Kind() == slog.KindGroup:
+				group, n, groupChanged := redact(attr.Value.Group())
+				result[i] = slog.Attr{Key: attr.Key, Value: slog.GroupValue(group...)}
+				count += n
+				changed = changed || groupChanged
+			case attr.Value.Kind() == slog.KindLogValuer:
+				// Redact lazy values when they resolve instead of forcing them now.
+				result[i] = slog.Attr{Key: attr.Key, Value: core.LazyValue(attr.Value, func(value slog.Value) slog.Value {
+					if value.Kind() != slog.KindGroup {
+						return value
+					}
+					group, n, _ := redact(value.Group())
+					metrics.AttrsRedacted.Add(float64(n))
+					return slog.GroupValue(group...)
+				})}
+				changed = true
+			default:
+				result[i] = attr
+			}
+		}
+		return result, count, changed || count > 0
+	}
+
+	return Hook{
+		Name: RedactHookName,
+		BeforeHandle: func(ctx context.Context, r *slog.Record) bool {
+			attrs := make([]slog.Attr, 0, r.NumAttrs())
+			r.Attrs(func(a slog.Attr) bool {
+				attrs = append(attrs, a)
+				return true
+			})
+
+			attrs, count, changed := redact(attrs)
+			if !changed {
+				return true
+			}
+			metrics.AttrsRedacted.Add(float64(count))
+
+			redactedRecord := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+			redactedRecord.AddAttrs(attrs...)
+			*r = redactedRecord
+			return true
+		},
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/metrics"
+)
+
+const SamplingHookName = "sampling"
+
+// SamplingHook keeps records at or above keepLevel and a rate fraction of the rest.
+func SamplingHook(rate float64, keepLevel slog.Level) Hook {
+	return Hook{
+		Name: SamplingHookName,
+		BeforeHandle: func(ctx context.Context, r *slog.Record) bool {
+			if r.Level >= keepLevel || rate >= 1 {
+				return true
+			}
+			if rate > 0 && rand.Float64() < rate {
+				metrics.RecordsSampled.Inc()
+				return true
+			}
+			return false
+		},
+	}
+}
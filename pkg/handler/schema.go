@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type FieldType int
+
+const (
+	TypeAny FieldType = iota
+	TypeString
+	TypeInt
+	TypeFloat
+	TypeBool
+	TypeDuration
+	TypeTime
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeDuration:
+		return "duration"
+	case TypeTime:
+		return "time"
+	default:
+		return "any"
+	}
+}
+
+func (t FieldType) matches(v slog.Value) bool {
+	switch t {
+	case TypeString:
+		return v.Kind() == slog.KindString
+	case TypeInt:
+		return v.Kind() == slog.KindInt64 || v.Kind() == slog.KindUint64
+	case TypeFloat:
+		return v.Kind() == slog.KindFloat64 || v.Kind() == slog.KindInt64 || v.Kind() == slog.KindUint64
+	case TypeBool:
+		return v.Kind() == slog.KindBool
+	case TypeDuration:
+		return v.Kind() == slog.KindDuration
+	case TypeTime:
+		return v.Kind() == slog.KindTime
+	default:
+		return true
+	}
+}
+
+type MismatchAction int
+
+const (
+	MismatchWarn MismatchAction = iota
+	MismatchDrop
+)
+
+type DuplicatePolicy int
+
+const (
+	DuplicateKeepLast DuplicatePolicy = iota
+	DuplicateKeepFirst
+	DuplicateSuffix
+)
+
+type FieldSpec struct {
+	Key     string
+	Type    FieldType
+	Aliases []string
+}
+
+type SchemaViolation struct {
+	Key      string
+	Expected FieldType
+	Got      slog.Kind
+	Dropped  bool
+}
+
+type Schema struct {
+	OnMismatch   MismatchAction
+	Duplicates   DuplicatePolicy
+	WarnInterval time.Duration
+
+	mu         sync.RWMutex
+	fields     map[string]FieldSpec
+	aliases    map[string]string
+	violations atomic.Int64
+
+	warnMu   sync.Mutex
+	lastWarn map[string]time.Time
+}
+
+func NewSchema(onMismatch MismatchAction, duplicates DuplicatePolicy) *Schema {
+	return &Schema{
+		OnMismatch:   onMismatch,
+		Duplicates:   duplicates,
+		WarnInterval: time.Minute,
+		fields:       make(map[string]FieldSpec),
+		aliases:      make(map[string]string),
+		lastWarn:     make(map[string]time.Time),
+	}
+}
+
+func (s *Schema) Register(specs ...FieldSpec) *Schema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, spec := range specs {
+		s.fields[spec.Key] = spec
+		for _, alias := range spec.Aliases {
+			s.aliases[alias] = spec.Key
+		}
+	}
+	return s
+}
+
+func (s *Schema) Violations() int64 {
+	return s.violations.Load()
+}
+
+// Apply normalizes aliases, checks declared types and resolves duplicate keys.
+func (s *Schema) Apply(attrs []slog.Attr) ([]slog.Attr, []SchemaViolation) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var violations []SchemaViolation
+	normalized := make([]slog.Attr, 0, len(attrs))
+
+	for _, attr := range attrs {
+		if canonical, ok := s.aliases[attr.Key]; ok {
+			attr.Key = canonical
+		}
+
+		if spec, ok := s.fields[attr.Key]; ok && !spec.Type.matches(attr.Value.Resolve()) {
+			s.violations.Add(1)
+			violation := SchemaViolation{
+				Key:      attr.Key,
+				Expected: spec.Type,
+				Got:      attr.Value.Resolve().Kind(),
+				Dropped:  s.OnMismatch == MismatchDrop,
+			}
+			violations = append(violations, violation)
+			if violation.Dropped {
+				continue
+			}
+		}
+
+		normalized = append(normalized, attr)
+	}
+
+	return s.resolveDuplicates(normalized), violations
+}
+
+func (s *Schema) resolveDuplicates(attrs []slog.Attr) []slog.Attr {
+	seen := make(map[string]int, len(attrs))
+	result := make([]slog.Attr, 0, len(attrs))
+
+	for _, attr := range attrs {
+		idx, exists := seen[attr.Key]
+		if !exists {
+			seen[attr.Key] = len(result)
+			result = append(result, attr)
+			continue
+		}
+
+		switch s.Duplicates {
+		case DuplicateKeepFirst:
+		case DuplicateSuffix:
+			for n := 2; ; n++ {
+				key := fmt.Sprintf("%s_%d", attr.Key, n)
+				if _, taken := seen[key]; !taken {
+					seen[key] = len(result)
+					result = append(result, slog.Attr{Key: key, Value: attr.Value})
+					break
+				}
+			}
+		default:
+			result[idx] = attr
+		}
+	}
+
+	return result
+}
+
+func (s *Schema) shouldWarn(key string, now time.Time) bool {
+	s.warnMu.Lock()
+	defer s.warnMu.Unlock()
+
+	if last, ok := s.lastWarn[key]; ok && now.Sub(last) < s.WarnInterval {
+		return false
+	}
+	s.lastWarn[key] = now
+	return true
+}
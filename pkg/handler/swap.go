@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// SwapHandler forwards to a handler that can be replaced at runtime, loggers
+// holding it pick up the replacement without being rebuilt. Swap returns
+// only after in-flight records are done with the previous handler, so its
+// sinks can be closed safely, while new records already go to the new one
+// instead of queueing behind a slow sink.
+type SwapHandler struct {
+	root *swapRoot
+	ops  []func(slog.Handler) slog.Handler
+
+	mu       sync.Mutex
+	cacheGen uint64
+	cache    slog.Handler
+}
+
+type swapRoot struct {
+	mu      sync.RWMutex
+	current *swapState
+}
+
+// swapState is one installed handler and the records still using it.
+type swapState struct {
+	handler  slog.Handler
+	gen      uint64
+	inflight sync.WaitGroup
+}
+
+func NewSwapHandler(h slog.Handler) *SwapHandler {
+	return &SwapHandler{root: &swapRoot{current: &swapState{handler: h, gen: 1}}}
+}
+
+// Swap installs h and returns the previous handler once no record is
+// being handled by it.
+func (s *SwapHandler) Swap(h slog.Handler) slog.Handler {
+	s.root.mu.Lock()
+	previous := s.root.current
+	s.root.current = &swapState{handler: h, gen: previous.gen + 1}
+	s.root.mu.Unlock()
+
+	previous.inflight.Wait()
+	return previous.handler
+}
+
+func (s *SwapHandler) Current() slog.Handler {
+	return s.load().handler
+}
+
+func (s *SwapHandler) load() *swapState {
+	s.root.mu.RLock()
+	defer s.root.mu.RUnlock()
+	return s.root.current
+}
+
+// acquire is load for Handle, the caller must call inflight.Done. Adding
+// under the read lock keeps Swap from missing a record that loaded the
+// previous state.
+func (s *SwapHandler) acquire() *swapState {
+	s.root.mu.RLock()
+	defer s.root.mu.RUnlock()
+	state := s.root.current
+	state.inflight.Add(1)
+	return state
+}
+
+// resolve applies WithAttrs/WithGroup calls to state's handler, caching
+// the result for the newest state seen.
+func (s *SwapHandler) resolve(state *swapState) slog.Handler {
+	if len(s.ops) == 0 {
+		return state.handler
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cacheGen == state.gen {
+		return s.cache
+	}
+
+	h := state.handler
+	for _, op := range s.ops {
+		h = op(h)
+	}
+	// A record still finishing on a swapped-out handler must not evict
+	// the current one from the cache.
+	if state.gen > s.cacheGen {
+		s.cache = h
+		s.cacheGen = state.gen
+	}
+	return h
+}
+
+func (s *SwapHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return s.resolve(s.load()).Enabled(ctx, level)
+}
+
+func (s *SwapHandler) Handle(ctx context.Context, r slog.Record) error {
+	state := s.acquire()
+	defer state.inflight.Done()
+	return s.resolve(state).Handle(ctx, r)
+}
+
+func (s *SwapHandler) with(op func(slog.Handler) slog.Handler) *SwapHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(s.ops), len(s.ops)+1)
+	copy(ops, s.ops)
+	return &SwapHandler{root: s.root, ops: append(ops, op)}
+}
+
+func (s *SwapHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return s.with(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (s *SwapHandler) WithGroup(name string) slog.Handler {
+	return s.with(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
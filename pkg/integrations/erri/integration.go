@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/aeternitas-infinita/rmlog/pkg/core"
 	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+	"github.com/aeternitas-infinita/rmlog/pkg/metrics"
 )
 
 type ErriType string
@@ -89,6 +91,7 @@ func Handle(ctx context.Context, err error, c *fiber.Ctx) (int, *HttpResponse) {
 	var internalErr *Erri
 	if errors.As(err, &internalErr) {
 		statusCode := internalErr.HTTPStatusCode()
+		metrics.ErriHandled.Inc(string(internalErr.Type), strconv.Itoa(statusCode))
 
 		if statusCode == http.StatusInternalServerError ||
 			internalErr.Type == ErriStruct.DATABASE {
@@ -122,6 +125,8 @@ func Handle(ctx context.Context, err error, c *fiber.Ctx) (int, *HttpResponse) {
 		}
 	}
 
+	metrics.ErriHandled.Inc("UNKNOWN", strconv.Itoa(http.StatusInternalServerError))
+
 	if c != nil {
 		requestInfo := extractRequestInfo(c)
 		handler.Log.ErrorContext(ctx, "handled error",
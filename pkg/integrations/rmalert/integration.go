@@ -0,0 +1,255 @@
+package rmalert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var ErrQueueFull = errors.New("alert queue is full")
+
+type Alert struct {
+	Level       slog.Level
+	Time        time.Time
+	Message     string
+	TraceID     string
+	Route       string
+	Error       string
+	Source      string
+	Fingerprint string
+	// Count is how many records with this fingerprint the alert stands for.
+	Count int
+	// Suppressed is how many were throttled since the previous alert.
+	Suppressed int
+	Attrs      map[string]any
+	// Context holds the records that preceded this one, see handler.FlightRecorder.
+	Context []slog.Record
+}
+
+type Batch struct {
+	Alerts []Alert
+	Digest bool
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, batch Batch) error
+}
+
+type Config struct {
+	// Name identifies the sink in rmlog.Health, defaults to "alert".
+	Name string
+	// MinLevel defaults to slog.LevelError.
+	MinLevel *slog.Level
+	// Match further restricts which records alert.
+	Match func(entry core.Entry) bool
+	// Fingerprint groups records for throttling and digests, defaults to level, message and route.
+	Fingerprint      func(entry core.Entry) string
+	ThrottleInterval time.Duration
+	// DigestInterval batches alerts into one notification per interval when set.
+	DigestInterval time.Duration
+	// QuietHours holds alerts until they end, then sends them as a digest.
+	QuietHours *QuietHours
+	QueueSize  int
+}
+
+type Sink struct {
+	config   Config
+	minLevel slog.Level
+	notifier Notifier
+	counters *core.SinkCounters
+
+	queue  chan Alert
+	done   chan struct{}
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	lastSent   map[string]time.Time
+	suppressed map[string]int
+	pending    []Alert
+	lastDigest time.Time
+}
+
+func NewSink(config Config, notifier Notifier) *Sink {
+	if config.Name == "" {
+		config.Name = "alert"
+	}
+	if config.Fingerprint == nil {
+		config.Fingerprint = DefaultFingerprint
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+
+	minLevel := slog.LevelError
+	if config.MinLevel != nil {
+		minLevel = *config.MinLevel
+	}
+
+	s := &Sink{
+		config:     config,
+		minLevel:   minLevel,
+		notifier:   notifier,
+		counters:   core.RegisterSinkCounters(config.Name),
+		queue:      make(chan Alert, config.QueueSize),
+		done:       make(chan struct{}),
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+		lastDigest: time.Now(),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *Sink) Name() string {
+	return s.config.Name
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	if entry.Level < s.minLevel {
+		return nil
+	}
+	if s.config.Match != nil && !s.config.Match(entry) {
+		return nil
+	}
+
+	alert := NewAlert(entry, s.config.Fingerprint(entry))
+	alert.Context = core.RecentRecords(ctx)
+
+	select {
+	case s.queue <- alert:
+		return nil
+	default:
+		s.counters.Failure(1, ErrQueueFull)
+		return ErrQueueFull
+	}
+}
+
+// Close sends what is queued or pending with one attempt each, notifier
+// retry waits are cut short.
+func (s *Sink) Close() error {
+	s.once.Do(func() {
+		s.cancel()
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+
+	tick := time.Minute
+	if s.config.DigestInterval > 0 && s.config.DigestInterval < tick {
+		tick = s.config.DigestInterval
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case alert := <-s.queue:
+			s.handle(alert)
+		case now := <-ticker.C:
+			s.pruneThrottle(now)
+			s.flushDigest(now, false)
+		case <-s.done:
+			for {
+				select {
+				case alert := <-s.queue:
+					s.handle(alert)
+				default:
+					s.flushDigest(time.Now(), true)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Sink) handle(alert Alert) {
+	now := time.Now()
+
+	if s.config.ThrottleInterval > 0 {
+		if last, ok := s.lastSent[alert.Fingerprint]; ok && now.Sub(last) < s.config.ThrottleInterval {
+			s.suppressed[alert.Fingerprint]++
+			return
+		}
+		s.lastSent[alert.Fingerprint] = now
+		alert.Suppressed = s.suppressed[alert.Fingerprint]
+		alert.Count += alert.Suppressed
+		delete(s.suppressed, alert.Fingerprint)
+	}
+
+	if s.config.DigestInterval > 0 || s.config.QuietHours.Active(now) {
+		s.addPending(alert)
+		return
+	}
+
+	s.notify(Batch{Alerts: []Alert{alert}})
+}
+
+// pruneThrottle forgets fingerprints whose throttle window has passed, so
+// high-cardinality messages do not grow lastSent forever. Their suppressed
+// counts go with them.
+func (s *Sink) pruneThrottle(now time.Time) {
+	for fingerprint, last := range s.lastSent {
+		if now.Sub(last) >= s.config.ThrottleInterval {
+			delete(s.lastSent, fingerprint)
+			delete(s.suppressed, fingerprint)
+		}
+	}
+}
+
+func (s *Sink) addPending(alert Alert) {
+	for i := range s.pending {
+		if s.pending[i].Fingerprint == alert.Fingerprint {
+			s.pending[i].Count += alert.Count
+			s.pending[i].Suppressed += alert.Suppressed
+			return
+		}
+	}
+	s.pending = append(s.pending, alert)
+}
+
+func (s *Sink) flushDigest(now time.Time, force bool) {
+	if len(s.pending) == 0 {
+		return
+	}
+	if !force {
+		if s.config.QuietHours.Active(now) {
+			return
+		}
+		if s.config.DigestInterval > 0 && now.Sub(s.lastDigest) < s.config.DigestInterval {
+			return
+		}
+	}
+
+	batch := Batch{Alerts: s.pending, Digest: true}
+	s.pending = nil
+	s.lastDigest = now
+	s.notify(batch)
+}
+
+func (s *Sink) notify(batch Batch) {
+	records := 0
+	for _, alert := range batch.Alerts {
+		records += alert.Count
+	}
+
+	if err := s.notifier.Notify(s.ctx, batch); err != nil {
+		s.counters.Failure(records, fmt.Errorf("%s: %w", s.config.Name, err))
+		return
+	}
+	s.counters.Success(records)
+}
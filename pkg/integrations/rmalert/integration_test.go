@@ -0,0 +1,418 @@
+package rmalert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+// recorder is a Notifier keeping every batch it is handed.
+type recorder struct {
+	mu      sync.Mutex
+	batches []Batch
+}
+
+func (r *recorder) Notify(ctx context.Context, batch Batch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, batch)
+	return nil
+}
+
+func (r *recorder) received() []Batch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Batch(nil), r.batches...)
+}
+
+func entry(level slog.Level, msg string, attrs ...slog.Attr) core.Entry {
+	return core.Entry{Time: testTime, Level: level, Message: msg, Attrs: attrs}
+}
+
+// summary reduces batches to "message xCount" per alert for comparison.
+func summary(batches []Batch) [][]string {
+	var out [][]string
+	for _, batch := range batches {
+		var alerts []string
+		for _, alert := range batch.Alerts {
+			alerts = append(alerts, fmt.Sprintf("%s x%d", alert.Message, alert.Count))
+		}
+		out = append(out, alerts)
+	}
+	return out
+}
+
+func TestSinkDelivery(t *testing.T) {
+	warn := slog.LevelWarn
+
+	tests := []struct {
+		name       string
+		config     Config
+		entries    []core.Entry
+		pause      time.Duration
+		after      []core.Entry
+		want       [][]string
+		wantDigest bool
+	}{
+		{
+			name:    "each alert is sent on its own",
+			entries: []core.Entry{entry(slog.LevelError, "a"), entry(slog.LevelError, "b")},
+			want:    [][]string{{"a x1"}, {"b x1"}},
+		},
+		{
+			name:    "records below the level are ignored",
+			config:  Config{MinLevel: &warn},
+			entries: []core.Entry{entry(slog.LevelInfo, "info"), entry(slog.LevelWarn, "warn")},
+			want:    [][]string{{"warn x1"}},
+		},
+		{
+			name:    "match filters records",
+			config:  Config{Match: func(e core.Entry) bool { return e.Message != "skip" }},
+			entries: []core.Entry{entry(slog.LevelError, "skip"), entry(slog.LevelError, "keep")},
+			want:    [][]string{{"keep x1"}},
+		},
+		{
+			name:    "throttling suppresses repeats and reports them with the next alert",
+			config:  Config{ThrottleInterval: 100 * time.Millisecond},
+			entries: []core.Entry{entry(slog.LevelError, "a"), entry(slog.LevelError, "a"), entry(slog.LevelError, "a"), entry(slog.LevelError, "b")},
+			pause:   150 * time.Millisecond,
+			after:   []core.Entry{entry(slog.LevelError, "a")},
+			want:    [][]string{{"a x1"}, {"b x1"}, {"a x3"}},
+		},
+		{
+			name:       "digest groups alerts by fingerprint",
+			config:     Config{DigestInterval: time.Hour},
+			entries:    []core.Entry{entry(slog.LevelError, "a"), entry(slog.LevelError, "b"), entry(slog.LevelError, "a")},
+			want:       [][]string{{"a x2", "b x1"}},
+			wantDigest: true,
+		},
+		{
+			name:       "quiet hours hold alerts for a digest",
+			config:     Config{QuietHours: &QuietHours{Start: 0, End: 24 * time.Hour}},
+			entries:    []core.Entry{entry(slog.LevelError, "a"), entry(slog.LevelError, "a", slog.String("route", "/x"))},
+			want:       [][]string{{"a x1", "a x1"}},
+			wantDigest: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &recorder{}
+			config := tt.config
+			config.Name = t.Name()
+			sink := NewSink(config, notifier)
+
+			for _, e := range tt.entries {
+				if err := sink.Write(context.Background(), e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.pause > 0 {
+				time.Sleep(tt.pause)
+			}
+			for _, e := range tt.after {
+				sink.Write(context.Background(), e)
+			}
+			sink.Close()
+
+			batches := notifier.received()
+			if got := summary(batches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batches = %v, want %v", got, tt.want)
+			}
+			for _, batch := range batches {
+				if batch.Digest != tt.wantDigest {
+					t.Errorf("digest = %v, want %v", batch.Digest, tt.wantDigest)
+				}
+			}
+		})
+	}
+}
+
+func TestSinkQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	notifier := notifierFunc(func(ctx context.Context, batch Batch) error {
+		<-block
+		return nil
+	})
+	sink := NewSink(Config{Name: t.Name(), QueueSize: 1}, notifier)
+	defer sink.Close()
+	defer close(block)
+
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = sink.Write(context.Background(), entry(slog.LevelError, "flood"))
+	}
+	if err != ErrQueueFull {
+		t.Errorf("error = %v, want ErrQueueFull", err)
+	}
+}
+
+type notifierFunc func(ctx context.Context, batch Batch) error
+
+func (f notifierFunc) Notify(ctx context.Context, batch Batch) error {
+	return f(ctx, batch)
+}
+
+func TestQuietHoursActive(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		quiet *QuietHours
+		time  time.Time
+		want  bool
+	}{
+		{name: "nil", quiet: nil, time: at(3, 0), want: false},
+		{name: "empty window", quiet: &QuietHours{Start: time.Hour, End: time.Hour}, time: at(1, 0), want: false},
+		{name: "inside day window", quiet: &QuietHours{Start: 9 * time.Hour, End: 17 * time.Hour}, time: at(12, 0), want: true},
+		{name: "end is exclusive", quiet: &QuietHours{Start: 9 * time.Hour, End: 17 * time.Hour}, time: at(17, 0), want: false},
+		{name: "before midnight in overnight window", quiet: &QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}, time: at(23, 30), want: true},
+		{name: "after midnight in overnight window", quiet: &QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}, time: at(6, 59), want: true},
+		{name: "outside overnight window", quiet: &QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour}, time: at(12, 0), want: false},
+		{name: "location", quiet: &QuietHours{Start: 22 * time.Hour, End: 7 * time.Hour, Location: time.FixedZone("UTC+3", 3*3600)}, time: at(20, 0), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quiet.Active(tt.time); got != tt.want {
+				t.Errorf("Active(%s) = %v, want %v", tt.time.Format("15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+type hookRequest struct {
+	header  http.Header
+	payload map[string]any
+}
+
+func newHookServer(t *testing.T, statuses ...int) (*httptest.Server, func() []hookRequest) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []hookRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("bad payload: %v", err)
+		}
+
+		mu.Lock()
+		requests = append(requests, hookRequest{header: r.Header.Clone(), payload: payload})
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []hookRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]hookRequest(nil), requests...)
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	alert := NewAlert(entry(slog.LevelError, "db down", slog.String("route", "/orders"), slog.String("error", "timeout")), "fp")
+	alert.TraceID = "abc"
+	alert.Suppressed = 2
+
+	tests := []struct {
+		name   string
+		config WebhookConfig
+		batch  Batch
+		check  func(t *testing.T, req hookRequest)
+	}{
+		{
+			name:  "default template",
+			batch: Batch{Alerts: []Alert{alert}},
+			check: func(t *testing.T, req hookRequest) {
+				want := "[ERROR] db down\nroute: /orders\ntrace_id: abc\nerror: timeout\n(+2 similar suppressed)"
+				if req.payload["text"] != want {
+					t.Errorf("text = %q, want %q", req.payload["text"], want)
+				}
+				if req.header.Get("Content-Type") != "application/json" {
+					t.Errorf("content type = %s", req.header.Get("Content-Type"))
+				}
+			},
+		},
+		{
+			name:  "default digest template",
+			batch: Batch{Alerts: []Alert{alert, {Level: slog.LevelWarn, Message: "slow", Count: 3}}, Digest: true},
+			check: func(t *testing.T, req hookRequest) {
+				want := "2 alert(s):\n- [ERROR] db down (/orders) x1 trace_id=abc error=timeout\n- [WARN] slow x3"
+				if req.payload["text"] != want {
+					t.Errorf("text = %q, want %q", req.payload["text"], want)
+				}
+			},
+		},
+		{
+			name: "custom template, text field, fields and headers",
+			config: WebhookConfig{
+				Template:  "{{.Message}} on {{.Route}}",
+				TextField: "message",
+				Fields:    map[string]any{"chat_id": "42"},
+				Headers:   map[string]string{"X-Token": "t"},
+			},
+			batch: Batch{Alerts: []Alert{alert}},
+			check: func(t *testing.T, req hookRequest) {
+				if req.payload["message"] != "db down on /orders" || req.payload["chat_id"] != "42" || req.payload["text"] != nil {
+					t.Errorf("payload = %v", req.payload)
+				}
+				if req.header.Get("X-Token") != "t" {
+					t.Errorf("headers = %v", req.header)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newHookServer(t)
+
+			config := tt.config
+			config.URL = server.URL
+			webhook, err := NewWebhook(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := webhook.Notify(context.Background(), tt.batch); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := received()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			tt.check(t, requests[0])
+		})
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	fast := &core.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1, MaxRetries: 3}
+
+	tests := []struct {
+		name     string
+		statuses []int
+		backoff  *core.Backoff
+		attempts int
+		wantErr  bool
+	}{
+		{name: "server errors are retried", statuses: []int{500, 503}, backoff: fast, attempts: 3},
+		{name: "client errors are not retried", statuses: []int{400}, backoff: fast, attempts: 1, wantErr: true},
+		{name: "empty backoff disables retries", statuses: []int{503}, backoff: &core.Backoff{}, attempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, received := newHookServer(t, tt.statuses...)
+
+			webhook, err := NewWebhook(WebhookConfig{URL: server.URL, Backoff: tt.backoff})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = webhook.Notify(context.Background(), Batch{Alerts: []Alert{{Message: "retry"}}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("notify error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := len(received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestNewWebhookErrors(t *testing.T) {
+	for name, config := range map[string]WebhookConfig{
+		"missing url":         {},
+		"bad template":        {URL: "http://hook", Template: "{{.Message"},
+		"bad digest template": {URL: "http://hook", DigestTemplate: "{{range}}"},
+	} {
+		if _, err := NewWebhook(config); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestCloseInterruptsRetry(t *testing.T) {
+	attempted := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := New(Config{Name: t.Name()}, WebhookConfig{
+		URL:     server.URL,
+		Backoff: &core.Backoff{Initial: time.Hour, MaxRetries: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.Write(context.Background(), entry(slog.LevelError, "stuck"))
+	<-attempted
+
+	start := time.Now()
+	sink.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s", elapsed)
+	}
+	if stats := sink.counters.Stats(); stats.Failures != 1 {
+		t.Errorf("failures = %d, want 1", stats.Failures)
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	sink := NewSink(Config{Name: t.Name()}, &recorder{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sink.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestThrottlePruned(t *testing.T) {
+	sink := NewSink(Config{Name: t.Name(), ThrottleInterval: time.Minute}, &recorder{})
+	defer sink.Close()
+
+	now := time.Now()
+	sink.lastSent["old"] = now.Add(-2 * time.Minute)
+	sink.suppressed["old"] = 3
+	sink.lastSent["recent"] = now.Add(-time.Second)
+
+	sink.pruneThrottle(now)
+
+	if _, ok := sink.lastSent["old"]; ok {
+		t.Error("expired fingerprint kept")
+	}
+	if _, ok := sink.suppressed["old"]; ok {
+		t.Error("expired suppressed count kept")
+	}
+	if _, ok := sink.lastSent["recent"]; !ok {
+		t.Error("throttled fingerprint pruned")
+	}
+}
@@ -0,0 +1,82 @@
+package rmalert
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+// QuietHours is a daily window given as offsets from midnight, End may be
+// before Start for windows spanning midnight.
+type QuietHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+func (q *QuietHours) Active(t time.Time) bool {
+	if q == nil || q.Start == q.End {
+		return false
+	}
+	if q.Location != nil {
+		t = t.In(q.Location)
+	}
+
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if q.Start < q.End {
+		return offset >= q.Start && offset < q.End
+	}
+	return offset >= q.Start || offset < q.End
+}
+
+var routeKeys = []string{"route", "request_route", "endpoint"}
+var errorKeys = []string{"error", "system_error"}
+
+func NewAlert(entry core.Entry, fingerprint string) Alert {
+	alert := Alert{
+		Level:       entry.Level,
+		Time:        entry.Time,
+		Message:     entry.Message,
+		TraceID:     entry.TraceID,
+		Fingerprint: fingerprint,
+		Count:       1,
+		Attrs:       make(map[string]any, len(entry.Attrs)),
+	}
+	if entry.File != "" {
+		alert.Source = fmt.Sprintf("%s:%d", entry.File, entry.Line)
+	}
+
+	for _, attr := range entry.Attrs {
+		alert.Attrs[attr.Key] = core.ValueToAny(attr.Value)
+	}
+	alert.Route = firstString(alert.Attrs, routeKeys)
+	alert.Error = firstString(alert.Attrs, errorKeys)
+
+	return alert
+}
+
+func DefaultFingerprint(entry core.Entry) string {
+	route := ""
+	for _, attr := range entry.Attrs {
+		for _, key := range routeKeys {
+			if attr.Key == key {
+				route = attr.Value.String()
+			}
+		}
+	}
+	return fmt.Sprintf("%s|%s|%s", entry.Level, entry.Message, route)
+}
+
+func firstString(attrs map[string]any, keys []string) string {
+	for _, key := range keys {
+		if value, ok := attrs[key]; ok && value != nil {
+			if s := fmt.Sprint(value); s != "" && s != "<nil>" {
+				return s
+			}
+		}
+	}
+	return ""
+}
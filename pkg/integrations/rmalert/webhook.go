@@ -0,0 +1,145 @@
+package rmalert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+const DefaultTemplate = `[{{.Level}}] {{.Message}}
+{{- if .Route}}
+route: {{.Route}}{{end}}
+{{- if .TraceID}}
+trace_id: {{.TraceID}}{{end}}
+{{- if .Error}}
+error: {{.Error}}{{end}}
+{{- if .Suppressed}}
+(+{{.Suppressed}} similar suppressed){{end}}`
+
+const DefaultDigestTemplate = `{{len .Alerts}} alert(s):
+{{- range .Alerts}}
+- [{{.Level}}] {{.Message}}{{if .Route}} ({{.Route}}){{end}} x{{.Count}}{{if .TraceID}} trace_id={{.TraceID}}{{end}}{{if .Error}} error={{.Error}}{{end}}
+{{- end}}`
+
+type WebhookConfig struct {
+	URL string
+	// Template renders a single alert, DigestTemplate a Batch.
+	Template       string
+	DigestTemplate string
+	// TextField is the payload field holding the rendered text, "text" for
+	// Slack and Mattermost style webhooks.
+	TextField string
+	// Fields are extra payload fields, e.g. "chat_id" for Telegram or "channel".
+	Fields  map[string]any
+	Headers map[string]string
+	// Backoff defaults to core.DefaultBackoff when nil, an empty Backoff
+	// disables retries.
+	Backoff *core.Backoff
+	Client  *http.Client
+}
+
+type Webhook struct {
+	config WebhookConfig
+	single *template.Template
+	digest *template.Template
+}
+
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+	if config.URL == "" {
+		return nil, errors.New("alert webhook URL is required")
+	}
+	if config.Template == "" {
+		config.Template = DefaultTemplate
+	}
+	if config.DigestTemplate == "" {
+		config.DigestTemplate = DefaultDigestTemplate
+	}
+	if config.TextField == "" {
+		config.TextField = "text"
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Backoff == nil {
+		backoff := core.DefaultBackoff
+		config.Backoff = &backoff
+	}
+
+	single, err := template.New("alert").Parse(config.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse alert template: %w", err)
+	}
+	digest, err := template.New("digest").Parse(config.DigestTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse digest template: %w", err)
+	}
+
+	return &Webhook{
+		config: config,
+		single: single,
+		digest: digest,
+	}, nil
+}
+
+// New builds an alert sink posting to an incoming webhook.
+func New(config Config, webhook WebhookConfig) (*Sink, error) {
+	notifier, err := NewWebhook(webhook)
+	if err != nil {
+		return nil, err
+	}
+	return NewSink(config, notifier), nil
+}
+
+// Notify posts batch, retrying per Backoff. Cancelling ctx ends the retry
+// waits but not a request in flight, so a closing Sink still gets its
+// last attempt out.
+func (w *Webhook) Notify(ctx context.Context, batch Batch) error {
+	var text bytes.Buffer
+	var err error
+	if batch.Digest {
+		err = w.digest.Execute(&text, batch)
+	} else {
+		err = w.single.Execute(&text, batch.Alerts[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to render alert: %w", err)
+	}
+
+	payload := make(map[string]any, len(w.config.Fields)+1)
+	for key, value := range w.config.Fields {
+		payload[key] = value
+	}
+	payload[w.config.TextField] = text.String()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	reqCtx := context.WithoutCancel(ctx)
+	return core.Retry(ctx, *w.config.Backoff, func() error {
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range w.config.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := w.config.Client.Do(req)
+		if err != nil {
+			return &core.RetryableError{Err: err}
+		}
+		defer resp.Body.Close()
+
+		return core.CheckHTTPResponse(resp)
+	})
+}
@@ -0,0 +1,369 @@
+package rmaudit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+)
+
+type Config struct {
+	Path string
+	// Key signs the chain, the same key is needed to verify it.
+	Key []byte
+	// Perm applies to a newly created file, defaults to 0600.
+	Perm os.FileMode
+	// SyncInterval batches fsyncs, 0 syncs after every record.
+	SyncInterval time.Duration
+	// MaxSize rotates the file once it grows past this many bytes, the
+	// chain continues in the new file. A failed rotation is retried after
+	// the next record. 0 disables rotation.
+	MaxSize int64
+	// MaxAge and MaxFiles prune rotated files, 0 keeps them.
+	MaxAge   time.Duration
+	MaxFiles int
+}
+
+// Sink appends hash-chained JSON lines to a file. Each line carries seq,
+// prev (the previous line's mac) and mac, an HMAC-SHA256 over the line
+// without its mac. Reopening a file continues its chain from the last
+// complete record.
+type Sink struct {
+	config   Config
+	counters *core.SinkCounters
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	dirty  bool
+	closed bool
+	seq    uint64
+	prev   string
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func New(config Config) (*Sink, error) {
+	if config.Path == "" {
+		return nil, errors.New("audit log path is required")
+	}
+	if len(config.Key) == 0 {
+		return nil, errors.New("audit log key is required")
+	}
+	if config.Perm == 0 {
+		config.Perm = 0o600
+	}
+
+	file, err := os.OpenFile(config.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, config.Perm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	seq, prev, size, torn, err := readHead(file)
+	if err == nil {
+		size, err = endLine(file, size)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to resume audit log %s: %w", config.Path, err)
+	}
+
+	s := &Sink{
+		config:   config,
+		counters: core.RegisterSinkCounters("audit"),
+		file:     file,
+		size:     size,
+		seq:      seq,
+		prev:     prev,
+		done:     make(chan struct{}),
+	}
+
+	// A crash mid-write leaves a torn last line. The chain resumes after the
+	// last complete record and Verify reports the torn line as malformed.
+	if torn {
+		s.counters.Failure(0, fmt.Errorf("audit log %s ends in an incomplete record, resumed after seq %d", config.Path, seq))
+	}
+
+	if config.SyncInterval > 0 {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+
+	return s, nil
+}
+
+// NewLogger returns a logger that writes only to an audit sink at path.
+func NewLogger(config Config, level slog.Level) (*slog.Logger, *Sink, error) {
+	sink, err := New(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := handler.NewCustomHandler(io.Discard, level, true, false).
+		SetName("audit").
+		AddSink(sink)
+	return slog.New(h), sink, nil
+}
+
+func (s *Sink) Name() string {
+	return "audit"
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("audit sink is closed")
+	}
+
+	line, mac, err := encodeLine(s.config.Key, s.seq+1, s.prev, entry)
+	if err != nil {
+		s.counters.Failure(1, err)
+		return err
+	}
+
+	if _, err := s.file.Write(line); err != nil {
+		s.counters.Failure(1, err)
+		return fmt.Errorf("failed to write audit record %d: %w", s.seq+1, err)
+	}
+
+	// The line is in the file now, so the chain moves on even if the sync
+	// below fails, otherwise the next record would reuse its seq.
+	s.seq++
+	s.prev = mac
+	s.size += int64(len(line))
+
+	if s.config.SyncInterval > 0 {
+		s.dirty = true
+	} else if err := s.file.Sync(); err != nil {
+		s.counters.Failure(1, err)
+		return fmt.Errorf("failed to sync audit record %d: %w", s.seq, err)
+	}
+	s.counters.Success(1)
+
+	// The record is safe at this point, a failed rotation keeps writing to
+	// the current file and shows up in the sink's health instead.
+	if s.config.MaxSize > 0 && s.size >= s.config.MaxSize {
+		if err := s.rotate(); err != nil {
+			s.counters.Failure(0, fmt.Errorf("failed to rotate audit log: %w", err))
+		}
+	}
+	return nil
+}
+
+// Rotate starts a new file now, regardless of MaxSize. On error the current
+// file stays in use.
+func (s *Sink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("audit sink is closed")
+	}
+	return s.rotate()
+}
+
+// Sync flushes written records to disk.
+func (s *Sink) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncLocked()
+}
+
+func (s *Sink) syncLocked() error {
+	if s.file == nil || !s.dirty {
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *Sink) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.Sync(); err != nil {
+				s.counters.Failure(0, err)
+			}
+		}
+	}
+}
+
+// rotate renames the current file with a timestamp suffix, opens a new one
+// and prunes rotated files. The current file is only replaced once the new
+// one is open, so a failure leaves the sink writing where it was. Callers
+// hold s.mu.
+func (s *Sink) rotate() error {
+	s.dirty = true
+	if err := s.syncLocked(); err != nil {
+		return err
+	}
+
+	rotated := s.config.Path + "." + time.Now().UTC().Format(rotateLayout)
+	if err := os.Rename(s.config.Path, rotated); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, s.config.Perm)
+	if err != nil {
+		return errors.Join(err, os.Rename(rotated, s.config.Path))
+	}
+
+	previous := s.file
+	s.file = file
+	s.size = 0
+
+	return errors.Join(previous.Close(), s.prune())
+}
+
+// Rotated lists rotated files of this sink, oldest first.
+func (s *Sink) Rotated() ([]string, error) {
+	return rotatedFiles(s.config.Path)
+}
+
+func (s *Sink) prune() error {
+	if s.config.MaxAge <= 0 && s.config.MaxFiles <= 0 {
+		return nil
+	}
+
+	files, err := rotatedFiles(s.config.Path)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, path := range files {
+		expired := s.config.MaxFiles > 0 && len(files)-i > s.config.MaxFiles
+		if !expired && s.config.MaxAge > 0 {
+			if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > s.config.MaxAge {
+				expired = true
+			}
+		}
+		if expired {
+			errs = append(errs, os.Remove(path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Head returns the last sequence number and mac. Storing them elsewhere
+// lets Verify detect records removed from the end of the file.
+func (s *Sink) Head() (uint64, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq, s.prev
+}
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	if s.file != nil {
+		err = errors.Join(s.file.Sync(), s.file.Close())
+		s.file = nil
+	}
+	s.mu.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+	return err
+}
+
+// readHead returns the sequence number and mac of the last complete record
+// in file, its size and whether incomplete lines follow that record. A file
+// without complete records continues the chain of the newest rotated file.
+func readHead(file *os.File) (uint64, string, int64, bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, "", 0, false, err
+	}
+	seq, prev, torn, err := readLastRecord(file)
+	if err != nil || seq != 0 {
+		return seq, prev, info.Size(), torn, err
+	}
+
+	files, err := rotatedFiles(file.Name())
+	if err != nil || len(files) == 0 {
+		return 0, genesis, info.Size(), torn, err
+	}
+	rotated, err := os.Open(files[len(files)-1])
+	if err != nil {
+		return 0, "", 0, false, err
+	}
+	defer rotated.Close()
+
+	seq, prev, _, err = readLastRecord(rotated)
+	if seq == 0 && err == nil {
+		prev = genesis
+	}
+	return seq, prev, info.Size(), torn, err
+}
+
+// readLastRecord returns the last record that parses and reports whether
+// lines that do not parse follow it, e.g. one torn by a crash mid-write.
+func readLastRecord(file *os.File) (uint64, string, bool, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, "", false, err
+	}
+
+	var seq uint64
+	var mac string
+	torn := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record, err := parseLine(scanner.Bytes())
+		if err != nil {
+			torn = true
+			continue
+		}
+		seq, mac, torn = record.Seq, record.MAC, false
+	}
+	return seq, mac, torn, scanner.Err()
+}
+
+// endLine appends a newline when file does not end with one, so the next
+// record starts on its own line after a torn one.
+func endLine(file *os.File, size int64) (int64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, size-1); err != nil {
+		return size, err
+	}
+	if last[0] == '\n' {
+		return size, nil
+	}
+	if _, err := file.Write([]byte{'\n'}); err != nil {
+		return size, err
+	}
+	return size + 1, nil
+}
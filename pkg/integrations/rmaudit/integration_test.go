@@ -0,0 +1,211 @@
+package rmaudit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var (
+	testKey  = []byte("audit-test-key")
+	testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+)
+
+func entry(msg string) core.Entry {
+	return core.Entry{Time: testTime, Level: slog.LevelInfo, Message: msg, Attrs: []slog.Attr{slog.String("actor", "alice")}}
+}
+
+func newSink(t *testing.T, config Config) *Sink {
+	t.Helper()
+	if config.Key == nil {
+		config.Key = testKey
+	}
+	sink, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+// writeChain writes n records named "<name> i" to a fresh file and returns
+// its lines.
+func writeChain(t *testing.T, name string, n int) (string, [][]byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink := newSink(t, Config{Path: path})
+	for i := 1; i <= n; i++ {
+		if err := sink.Write(context.Background(), entry(fmt.Sprintf("%s %d", name, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+	return path, readLines(t, path)
+}
+
+func readLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+func verify(t *testing.T, path string, opts VerifyOptions) *Report {
+	t.Helper()
+	report, err := VerifyFile(path, testKey, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func kinds(report *Report) []ProblemKind {
+	var out []ProblemKind
+	for _, p := range report.Problems {
+		out = append(out, p.Kind)
+	}
+	return out
+}
+
+func TestSinkChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink := newSink(t, Config{Path: path})
+
+	for i := 0; i < 3; i++ {
+		sink.Write(context.Background(), entry("first run"))
+	}
+	sink.Close()
+
+	reopened := newSink(t, Config{Path: path})
+	if seq, _ := reopened.Head(); seq != 3 {
+		t.Fatalf("resumed at seq %d, want 3", seq)
+	}
+	reopened.Write(context.Background(), entry("second run"))
+	seq, mac := reopened.Head()
+	reopened.Close()
+
+	report := verify(t, path, VerifyOptions{ExpectSeq: seq, ExpectMAC: mac})
+	if !report.OK() {
+		t.Errorf("problems: %v", report.Problems)
+	}
+	if report.Records != 4 || report.FirstSeq != 1 || report.LastSeq != 4 {
+		t.Errorf("report = %+v, want 4 records seq 1..4", report)
+	}
+}
+
+func TestSinkResumeAfterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink := newSink(t, Config{Path: path})
+	sink.Write(context.Background(), entry("before rotation"))
+	sink.Write(context.Background(), entry("before rotation"))
+	if err := sink.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// The live file is empty, the chain continues from the rotated file.
+	reopened := newSink(t, Config{Path: path})
+	reopened.Write(context.Background(), entry("after rotation"))
+	reopened.Close()
+
+	rotated, err := reopened.Rotated()
+	if err != nil || len(rotated) != 1 {
+		t.Fatalf("rotated files = %v, %v", rotated, err)
+	}
+	first := verify(t, rotated[0], VerifyOptions{})
+	second := verify(t, path, VerifyOptions{AnchorSeq: first.LastSeq, AnchorMAC: first.LastMAC})
+	if !first.OK() || !second.OK() {
+		t.Errorf("problems: %v %v", first.Problems, second.Problems)
+	}
+	if second.FirstSeq != 3 {
+		t.Errorf("live file starts at seq %d, want 3", second.FirstSeq)
+	}
+}
+
+func TestSinkRotatesAtMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink := newSink(t, Config{Path: path, MaxSize: 1, MaxFiles: 2})
+	for i := 0; i < 4; i++ {
+		if err := sink.Write(context.Background(), entry("rotate me")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := sink.Rotated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Errorf("kept %d rotated files, want 2", len(rotated))
+	}
+}
+
+func TestSinkResumeAfterTornRecord(t *testing.T) {
+	path, lines := writeChain(t, "record", 2)
+
+	torn := lines[1][:len(lines[1])/2]
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(torn)
+	f.Close()
+
+	sink := newSink(t, Config{Path: path})
+	if seq, _ := sink.Head(); seq != 2 {
+		t.Fatalf("resumed at seq %d, want 2", seq)
+	}
+	if stats := sink.counters.Stats(); stats.LastError == "" {
+		t.Error("torn record not reported in health")
+	}
+	if err := sink.Write(context.Background(), entry("after crash")); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	report := verify(t, path, VerifyOptions{})
+	want := []ProblemKind{ProblemMalformed}
+	if got := kinds(report); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("problems = %v, want %v", report.Problems, want)
+	}
+	if report.Records != 3 || report.LastSeq != 3 {
+		t.Errorf("report = %+v, want 3 records ending at seq 3", report)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, config := range map[string]Config{
+		"missing path": {Key: testKey},
+		"missing key":  {Path: filepath.Join(dir, "audit.log")},
+		"bad dir":      {Path: filepath.Join(dir, "missing", "audit.log"), Key: testKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if sink, err := New(config); err == nil {
+				sink.Close()
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	sink := newSink(t, Config{Path: filepath.Join(t.TempDir(), "audit.log"), SyncInterval: time.Millisecond})
+	sink.Close()
+	if err := sink.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	if err := sink.Write(context.Background(), entry("late")); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Errorf("write after close = %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package rmaudit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+const maxLineSize = 4 << 20
+
+const rotateLayout = "20060102T150405.000000000Z"
+
+// genesis is the prev value of the first record in a chain.
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+var macMarker = []byte(`,"mac":"`)
+
+type chainRecord struct {
+	Seq     uint64
+	Prev    string
+	MAC     string
+	payload []byte
+}
+
+func encodeLine(key []byte, seq uint64, prev string, entry core.Entry) ([]byte, string, error) {
+	m := core.EntryToMap(entry)
+	delete(m, "mac")
+	m["seq"] = seq
+	m["prev"] = prev
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, "", err
+	}
+	mac := computeMAC(key, payload)
+
+	line := make([]byte, 0, len(payload)+len(macMarker)+len(mac)+3)
+	line = append(line, payload[:len(payload)-1]...)
+	line = append(line, macMarker...)
+	line = append(line, mac...)
+	line = append(line, "\"}\n"...)
+	return line, mac, nil
+}
+
+// parseLine splits a line into its signed payload and mac.
+func parseLine(line []byte) (chainRecord, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	idx := bytes.LastIndex(line, macMarker)
+	if idx < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return chainRecord{}, errors.New("missing mac")
+	}
+
+	payload := append(line[:idx:idx], '}')
+	var header struct {
+		Seq  uint64 `json:"seq"`
+		Prev string `json:"prev"`
+	}
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return chainRecord{}, err
+	}
+	if header.Seq == 0 {
+		return chainRecord{}, errors.New("missing seq")
+	}
+
+	return chainRecord{
+		Seq:     header.Seq,
+		Prev:    header.Prev,
+		MAC:     string(line[idx+len(macMarker) : len(line)-2]),
+		payload: payload,
+	}, nil
+}
+
+func computeMAC(key, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// rotatedFiles returns path.<timestamp> files, oldest first.
+func rotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	files := matches[:0]
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, path+".")
+		if _, err := time.Parse(rotateLayout, suffix); err == nil {
+			files = append(files, match)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
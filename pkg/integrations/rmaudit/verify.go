@@ -0,0 +1,138 @@
+package rmaudit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"os"
+)
+
+type ProblemKind string
+
+const (
+	ProblemMalformed ProblemKind = "malformed"
+	ProblemModified  ProblemKind = "modified"
+	ProblemGap       ProblemKind = "gap"
+	ProblemReordered ProblemKind = "reordered"
+	ProblemChain     ProblemKind = "chain"
+	ProblemHead      ProblemKind = "head"
+)
+
+type Problem struct {
+	Line   int
+	Seq    uint64
+	Kind   ProblemKind
+	Detail string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d (seq %d): %s: %s", p.Line, p.Seq, p.Kind, p.Detail)
+}
+
+type Report struct {
+	Records  int
+	FirstSeq uint64
+	LastSeq  uint64
+	LastMAC  string
+	Problems []Problem
+}
+
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// VerifyOptions compares the end of the chain with a head saved from
+// Sink.Head, which is the only way to notice records cut off the end.
+//
+// AnchorSeq and AnchorMAC are the head of the chain a file continues, e.g.
+// LastSeq and LastMAC of the previous rotated file. Without them the first
+// record must be seq 1 with the genesis prev, so records cut off the start
+// are reported too.
+type VerifyOptions struct {
+	ExpectSeq uint64
+	ExpectMAC string
+	AnchorSeq uint64
+	AnchorMAC string
+}
+
+// Verify checks every line of an audit log: macs must match the content,
+// sequence numbers must increase by one from the anchor and each prev must
+// equal the mac of the line before it.
+func Verify(r io.Reader, key []byte, opts VerifyOptions) (*Report, error) {
+	report := &Report{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	expected := opts.AnchorSeq + 1
+	prev := genesis
+	if opts.AnchorSeq > 0 {
+		prev = opts.AnchorMAC
+	}
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		problem := func(seq uint64, kind ProblemKind, format string, args ...any) {
+			report.Problems = append(report.Problems, Problem{Line: lineNo, Seq: seq, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+		}
+
+		record, err := parseLine(line)
+		if err != nil {
+			problem(0, ProblemMalformed, "%v", err)
+			continue
+		}
+		report.Records++
+
+		if !hmac.Equal([]byte(record.MAC), []byte(computeMAC(key, record.payload))) {
+			problem(record.Seq, ProblemModified, "mac does not match content")
+		}
+
+		if report.Records == 1 {
+			report.FirstSeq = record.Seq
+		}
+
+		switch {
+		case record.Seq > expected:
+			problem(record.Seq, ProblemGap, "expected seq %d, %d records missing", expected, record.Seq-expected)
+		case record.Seq < expected:
+			problem(record.Seq, ProblemReordered, "expected seq %d", expected)
+		case record.Prev != prev && report.Records == 1:
+			problem(record.Seq, ProblemChain, "first record does not continue the anchor")
+		case record.Prev != prev:
+			problem(record.Seq, ProblemChain, "prev does not match the previous record")
+		}
+
+		expected = record.Seq + 1
+		prev = record.MAC
+		report.LastSeq = record.Seq
+		report.LastMAC = record.MAC
+	}
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	if opts.ExpectSeq != 0 && (report.LastSeq != opts.ExpectSeq || (opts.ExpectMAC != "" && report.LastMAC != opts.ExpectMAC)) {
+		report.Problems = append(report.Problems, Problem{
+			Line:   lineNo,
+			Seq:    report.LastSeq,
+			Kind:   ProblemHead,
+			Detail: fmt.Sprintf("chain ends at seq %d, expected %d", report.LastSeq, opts.ExpectSeq),
+		})
+	}
+
+	return report, nil
+}
+
+func VerifyFile(path string, key []byte, opts VerifyOptions) (*Report, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Verify(file, key, opts)
+}
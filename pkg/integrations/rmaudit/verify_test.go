@@ -0,0 +1,113 @@
+package rmaudit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	_, lines := writeChain(t, "record", 4)
+	_, other := writeChain(t, "other", 4)
+	head := func(i int) (uint64, string) {
+		record, err := parseLine(lines[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record.Seq, record.MAC
+	}
+	lastSeq, lastMAC := head(3)
+	anchorSeq, anchorMAC := head(1)
+
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name string
+		data []byte
+		opts VerifyOptions
+		want []ProblemKind
+	}{
+		{
+			name: "intact chain",
+			data: join(lines...),
+			opts: VerifyOptions{ExpectSeq: lastSeq, ExpectMAC: lastMAC},
+		},
+		{
+			name: "modified content",
+			data: join(lines[0], bytes.Replace(lines[1], []byte("record 2"), []byte("record X"), 1), lines[2], lines[3]),
+			want: []ProblemKind{ProblemModified},
+		},
+		{
+			name: "removed record",
+			data: join(lines[0], lines[2], lines[3]),
+			want: []ProblemKind{ProblemGap},
+		},
+		{
+			name: "reordered records",
+			data: join(lines[0], lines[2], lines[1], lines[3]),
+			want: []ProblemKind{ProblemGap, ProblemReordered, ProblemGap},
+		},
+		{
+			name: "record from another chain",
+			data: join(lines[0], other[1], lines[2], lines[3]),
+			want: []ProblemKind{ProblemChain, ProblemChain},
+		},
+		{
+			name: "records cut off the end",
+			data: join(lines[:3]...),
+			opts: VerifyOptions{ExpectSeq: lastSeq, ExpectMAC: lastMAC},
+			want: []ProblemKind{ProblemHead},
+		},
+		{
+			name: "last record replaced",
+			data: join(lines[0], lines[1], lines[2], other[3]),
+			opts: VerifyOptions{ExpectSeq: lastSeq, ExpectMAC: lastMAC},
+			want: []ProblemKind{ProblemChain, ProblemHead},
+		},
+		{
+			name: "records cut off the start",
+			data: join(lines[2:]...),
+			want: []ProblemKind{ProblemGap},
+		},
+		{
+			name: "continuation with anchor",
+			data: join(lines[2:]...),
+			opts: VerifyOptions{AnchorSeq: anchorSeq, AnchorMAC: anchorMAC},
+		},
+		{
+			name: "continuation with wrong anchor",
+			data: join(lines[2:]...),
+			opts: VerifyOptions{AnchorSeq: anchorSeq, AnchorMAC: genesis},
+			want: []ProblemKind{ProblemChain},
+		},
+		{
+			name: "malformed line",
+			data: join(lines[0], lines[1], []byte("not a record\n"), lines[2], lines[3]),
+			want: []ProblemKind{ProblemMalformed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Verify(bytes.NewReader(tt.data), testKey, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := kinds(report); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("problems = %v, want kinds %v", report.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	_, lines := writeChain(t, "record", 2)
+
+	report, err := Verify(bytes.NewReader(bytes.Join(lines, nil)), []byte("other key"), VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := kinds(report); fmt.Sprint(got) != fmt.Sprint([]ProblemKind{ProblemModified, ProblemModified}) {
+		t.Errorf("problems = %v, want every record modified", report.Problems)
+	}
+}
@@ -0,0 +1,221 @@
+package rmelastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Config struct {
+	// URL is the cluster base URL, the sink posts to URL + "/_bulk".
+	URL string
+	// Index is the index name, or its prefix when DateLayout is set.
+	Index string
+	// DateLayout appends the record date to Index, e.g. "2006.01.02".
+	DateLayout string
+	Username   string
+	Password   string
+	APIKey     string
+	Headers    map[string]string
+	Batch      core.BatchConfig
+	// Backoff defaults to core.DefaultBackoff when nil, an empty Backoff
+	// disables retries.
+	Backoff *core.Backoff
+	Client  *http.Client
+	// DeadLetter receives documents that were rejected or ran out of retries.
+	DeadLetter func(doc []byte, reason string)
+}
+
+var errSinkClosed = errors.New("elasticsearch sink closed while retrying")
+
+type document struct {
+	index string
+	body  []byte
+}
+
+type Sink struct {
+	config  Config
+	batcher *core.Batcher[document]
+	done    chan struct{}
+	once    sync.Once
+}
+
+func New(config Config) (*Sink, error) {
+	if config.URL == "" {
+		return nil, errors.New("elasticsearch URL is required")
+	}
+	if config.Index == "" {
+		return nil, errors.New("elasticsearch index is required")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Backoff == nil {
+		backoff := core.DefaultBackoff
+		config.Backoff = &backoff
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+
+	s := &Sink{config: config, done: make(chan struct{})}
+	s.batcher = core.NewBatcher(config.Batch, s.bulk)
+
+	return s, nil
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	doc := core.EntryToMap(entry)
+	doc["@timestamp"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	delete(doc, "time")
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode elasticsearch document: %w", err)
+	}
+
+	return s.batcher.Add(document{
+		index: s.indexName(entry.Time),
+		body:  body,
+	})
+}
+
+func (s *Sink) Flush() error {
+	return s.batcher.Flush()
+}
+
+// Close stops pending retry waits, so the final flush makes one attempt
+// and dead-letters what it could not send.
+func (s *Sink) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.batcher.Close()
+}
+
+func (s *Sink) indexName(t time.Time) string {
+	if s.config.DateLayout == "" {
+		return s.config.Index
+	}
+	return s.config.Index + "-" + t.UTC().Format(s.config.DateLayout)
+}
+
+// bulk sends docs and resends only the items that failed with a retryable
+// status, anything else is dead-lettered.
+func (s *Sink) bulk(docs []document) error {
+	pending := docs
+	deadLettered := 0
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		failed, err := s.send(pending)
+		if err != nil {
+			var retryable *core.RetryableError
+			if !errors.As(err, &retryable) || attempt >= s.config.Backoff.MaxRetries {
+				s.deadLetter(pending, err.Error())
+				return err
+			}
+			if !s.wait(s.config.Backoff.RetryDelay(attempt, retryable.After)) {
+				s.deadLetter(pending, "sink closed")
+				return errors.Join(err, errSinkClosed)
+			}
+			continue
+		}
+
+		pending = pending[:0:0]
+		for _, item := range failed {
+			if item.retryable && attempt < s.config.Backoff.MaxRetries {
+				pending = append(pending, item.doc)
+				continue
+			}
+			s.deadLetter([]document{item.doc}, item.reason)
+			deadLettered++
+		}
+
+		if len(pending) > 0 && !s.wait(s.config.Backoff.Delay(attempt)) {
+			s.deadLetter(pending, "sink closed")
+			deadLettered += len(pending)
+			break
+		}
+	}
+
+	if deadLettered > 0 {
+		return fmt.Errorf("%d of %d documents rejected by bulk API", deadLettered, len(docs))
+	}
+	return nil
+}
+
+// wait sleeps for d and reports false when the sink was closed meanwhile.
+func (s *Sink) wait(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-s.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+type failedItem struct {
+	doc       document
+	reason    string
+	retryable bool
+}
+
+func (s *Sink) send(docs []document) ([]failedItem, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, _ := json.Marshal(map[string]any{"index": map[string]string{"_index": doc.index}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.config.URL+"/_bulk", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case s.config.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.config.APIKey)
+	case s.config.Username != "":
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+	for key, value := range s.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, &core.RetryableError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	if err := core.CheckHTTPResponse(resp); err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &core.RetryableError{Err: err}
+	}
+
+	return parseBulkResponse(respBody, docs)
+}
+
+func (s *Sink) deadLetter(docs []document, reason string) {
+	if s.config.DeadLetter == nil {
+		return
+	}
+	for _, doc := range docs {
+		s.config.DeadLetter(doc.body, reason)
+	}
+}
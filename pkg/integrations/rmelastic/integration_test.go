@@ -0,0 +1,286 @@
+package rmelastic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+type bulkRequest struct {
+	header  http.Header
+	indices []string
+	docs    []map[string]any
+}
+
+// bulkServer stands in for the _bulk endpoint. respond decides the answer
+// for each request, by default every item succeeds.
+type bulkServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []bulkRequest
+	respond  func(n int, req bulkRequest) (int, string)
+}
+
+func newBulkServer(t *testing.T, respond func(n int, req bulkRequest) (int, string)) *bulkServer {
+	t.Helper()
+
+	s := &bulkServer{respond: respond}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		req := bulkRequest{header: r.Header.Clone()}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Errorf("bad action line %q", scanner.Text())
+			}
+			req.indices = append(req.indices, action["index"]["_index"])
+
+			scanner.Scan()
+			var doc map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				t.Errorf("bad document line %q", scanner.Text())
+			}
+			req.docs = append(req.docs, doc)
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		n := len(s.requests)
+		s.mu.Unlock()
+
+		status, body := http.StatusOK, `{"errors":false,"items":[]}`
+		if s.respond != nil {
+			status, body = s.respond(n, req)
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *bulkServer) received() []bulkRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]bulkRequest(nil), s.requests...)
+}
+
+// itemsResponse builds a bulk response with one item per status.
+func itemsResponse(statuses ...int) string {
+	items := make([]string, len(statuses))
+	for i, status := range statuses {
+		if status < 300 {
+			items[i] = fmt.Sprintf(`{"index":{"status":%d}}`, status)
+		} else {
+			items[i] = fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"t%d","reason":"r%d"}}}`, status, status, status)
+		}
+	}
+	return `{"errors":true,"items":[` + strings.Join(items, ",") + `]}`
+}
+
+func messages(docs []map[string]any) []string {
+	var msgs []string
+	for _, doc := range docs {
+		msgs = append(msgs, fmt.Sprint(doc["message"]))
+	}
+	return msgs
+}
+
+func fastBackoff(retries int) *core.Backoff {
+	return &core.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1, MaxRetries: retries}
+}
+
+func entry(msg string) core.Entry {
+	return core.Entry{Time: testTime, Level: slog.LevelInfo, Message: msg, Attrs: []slog.Attr{slog.Int("n", 1)}}
+}
+
+func TestSinkBulk(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		respond      func(n int, req bulkRequest) (int, string)
+		entries      []string
+		wantRequests [][]string
+		wantDead     []string
+		wantErr      bool
+		check        func(t *testing.T, requests []bulkRequest)
+	}{
+		{
+			name:         "documents and daily index",
+			config:       Config{Index: "logs", DateLayout: "2006.01.02", APIKey: "key"},
+			entries:      []string{"a", "b"},
+			wantRequests: [][]string{{"a", "b"}},
+			check: func(t *testing.T, requests []bulkRequest) {
+				req := requests[0]
+				if !reflect.DeepEqual(req.indices, []string{"logs-2024.03.01", "logs-2024.03.01"}) {
+					t.Errorf("indices = %v", req.indices)
+				}
+				if req.header.Get("Authorization") != "ApiKey key" {
+					t.Errorf("authorization = %q", req.header.Get("Authorization"))
+				}
+				doc := req.docs[0]
+				if doc["@timestamp"] != "2024-03-01T12:30:45Z" || doc["time"] != nil || doc["level"] != "INFO" || doc["n"] != float64(1) {
+					t.Errorf("document = %v", doc)
+				}
+			},
+		},
+		{
+			name:   "only retryable items are resent",
+			config: Config{Index: "logs", Backoff: fastBackoff(3)},
+			respond: func(n int, req bulkRequest) (int, string) {
+				if n == 1 {
+					return http.StatusOK, itemsResponse(201, 429, 400, 503)
+				}
+				return http.StatusOK, itemsResponse(201, 201)
+			},
+			entries:      []string{"ok", "throttled", "bad", "unavailable"},
+			wantRequests: [][]string{{"ok", "throttled", "bad", "unavailable"}, {"throttled", "unavailable"}},
+			wantDead:     []string{"bad"},
+			wantErr:      true,
+		},
+		{
+			name:   "item retries run out",
+			config: Config{Index: "logs", Backoff: fastBackoff(1)},
+			respond: func(n int, req bulkRequest) (int, string) {
+				return http.StatusOK, itemsResponse(429)
+			},
+			entries:      []string{"throttled"},
+			wantRequests: [][]string{{"throttled"}, {"throttled"}},
+			wantDead:     []string{"throttled"},
+			wantErr:      true,
+		},
+		{
+			name:   "whole request is retried on server error",
+			config: Config{Index: "logs", Backoff: fastBackoff(3)},
+			respond: func(n int, req bulkRequest) (int, string) {
+				if n == 1 {
+					return http.StatusServiceUnavailable, "busy"
+				}
+				return http.StatusOK, `{"errors":false,"items":[]}`
+			},
+			entries:      []string{"a", "b"},
+			wantRequests: [][]string{{"a", "b"}, {"a", "b"}},
+		},
+		{
+			name:   "empty backoff disables retries",
+			config: Config{Index: "logs", Backoff: &core.Backoff{}},
+			respond: func(n int, req bulkRequest) (int, string) {
+				return http.StatusServiceUnavailable, "busy"
+			},
+			entries:      []string{"a"},
+			wantRequests: [][]string{{"a"}},
+			wantDead:     []string{"a"},
+			wantErr:      true,
+		},
+		{
+			name:   "client errors are dead-lettered",
+			config: Config{Index: "logs", Backoff: fastBackoff(3)},
+			respond: func(n int, req bulkRequest) (int, string) {
+				return http.StatusBadRequest, "bad"
+			},
+			entries:      []string{"a"},
+			wantRequests: [][]string{{"a"}},
+			wantDead:     []string{"a"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newBulkServer(t, tt.respond)
+
+			var dead []string
+			config := tt.config
+			config.URL = server.URL + "/"
+			config.Batch.Interval = time.Hour
+			config.DeadLetter = func(doc []byte, reason string) {
+				var decoded map[string]any
+				json.Unmarshal(doc, &decoded)
+				dead = append(dead, fmt.Sprint(decoded["message"]))
+			}
+			sink, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+
+			for _, msg := range tt.entries {
+				sink.Write(context.Background(), entry(msg))
+			}
+			err = sink.Flush()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("flush error = %v, want error %v", err, tt.wantErr)
+			}
+
+			requests := server.received()
+			var got [][]string
+			for _, req := range requests {
+				got = append(got, messages(req.docs))
+			}
+			if !reflect.DeepEqual(got, tt.wantRequests) {
+				t.Errorf("requests = %v, want %v", got, tt.wantRequests)
+			}
+			if !reflect.DeepEqual(dead, tt.wantDead) {
+				t.Errorf("dead letters = %v, want %v", dead, tt.wantDead)
+			}
+			if tt.check != nil {
+				tt.check(t, requests)
+			}
+		})
+	}
+}
+
+func TestCloseInterruptsRetry(t *testing.T) {
+	attempted := make(chan struct{}, 10)
+	server := newBulkServer(t, func(n int, req bulkRequest) (int, string) {
+		attempted <- struct{}{}
+		return http.StatusServiceUnavailable, "busy"
+	})
+
+	var dead int
+	sink, err := New(Config{
+		URL:        server.URL,
+		Index:      "logs",
+		Backoff:    &core.Backoff{Initial: time.Hour, MaxRetries: 5},
+		Batch:      core.BatchConfig{Interval: time.Hour},
+		DeadLetter: func(doc []byte, reason string) { dead++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.Write(context.Background(), entry("stuck"))
+	flushed := make(chan error)
+	go func() { flushed <- sink.Flush() }()
+	<-attempted
+
+	start := time.Now()
+	sink.Close()
+	if err := <-flushed; err == nil {
+		t.Error("interrupted flush reported success")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s", elapsed)
+	}
+	if dead != 1 {
+		t.Errorf("dead letters = %d, want 1", dead)
+	}
+}
@@ -0,0 +1,54 @@
+package rmelastic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error,omitempty"`
+}
+
+func parseBulkResponse(body []byte, docs []document) ([]failedItem, error) {
+	var resp bulkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil, nil
+	}
+	if len(resp.Items) != len(docs) {
+		return nil, fmt.Errorf("bulk response has %d items for %d documents", len(resp.Items), len(docs))
+	}
+
+	var failed []failedItem
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+
+			reason := fmt.Sprintf("status %d", result.Status)
+			if result.Error != nil {
+				reason = fmt.Sprintf("%s: %s: %s", reason, result.Error.Type, result.Error.Reason)
+			}
+
+			failed = append(failed, failedItem{
+				doc:       docs[i],
+				reason:    reason,
+				retryable: result.Status == http.StatusTooManyRequests || result.Status >= 500,
+			})
+		}
+	}
+	return failed, nil
+}
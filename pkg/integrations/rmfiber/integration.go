@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/getsentry/sentry-go"
@@ -15,6 +16,7 @@ import (
 	"github.com/aeternitas-infinita/rmlog/pkg/core"
 	"github.com/aeternitas-infinita/rmlog/pkg/handler"
 	"github.com/aeternitas-infinita/rmlog/pkg/integrations/erri"
+	"github.com/aeternitas-infinita/rmlog/pkg/metrics"
 )
 
 type userIDProvider interface {
@@ -66,6 +68,8 @@ func RecoverMiddleware(c *fiber.Ctx) error {
 				})
 			}
 
+			metrics.HTTPPanics.Inc(c.Route().Path)
+
 			stackTrace := string(debug.Stack())
 			errorLoc := core.ExtractErrorLocation(stackTrace)
 
@@ -100,6 +104,8 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 	}
 
 	if code >= 500 {
+		metrics.HTTPServerErrors.Inc(c.Route().Path, strconv.Itoa(code), "error_handler")
+
 		if hub := sentryfiber.GetHubFromContext(c); hub != nil {
 			hub.WithScope(func(scope *sentry.Scope) {
 				scope.AddEventProcessor(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
@@ -195,6 +201,8 @@ func CaptureErrorMiddleware(c *fiber.Ctx) error {
 		}
 
 		if code >= 500 {
+			metrics.HTTPServerErrors.Inc(c.Route().Path, strconv.Itoa(code), "middleware")
+
 			if hub := sentryfiber.GetHubFromContext(c); hub != nil {
 				hub.WithScope(func(scope *sentry.Scope) {
 					scope.AddEventProcessor(func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
@@ -279,3 +287,51 @@ func CaptureErrorMiddleware(c *fiber.Ctx) error {
 
 	return err
 }
+
+func MetricsHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return metrics.Default.WriteText(c.Response().BodyWriter())
+}
+
+// LevelRegistry is the named logger registry LevelsHandler manages,
+// rmlog.Levels implements it.
+type LevelRegistry interface {
+	Loggers() []core.LoggerInfo
+	SetLoggerLevel(name string, level slog.Level)
+	ResetLoggerLevel(name string)
+}
+
+// LevelsHandler is an admin endpoint for Named logger levels. GET lists
+// loggers, PUT/POST with {"name": "billing", "level": "debug"} sets a level
+// and DELETE ?name=billing makes the logger inherit again.
+func LevelsHandler(registry LevelRegistry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet:
+			return c.JSON(registry.Loggers())
+		case fiber.MethodPut, fiber.MethodPost:
+			var body struct {
+				Name  string `json:"name"`
+				Level string `json:"level"`
+			}
+			if err := c.BodyParser(&body); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+			var level slog.Level
+			if body.Name == "" || level.UnmarshalText([]byte(body.Level)) != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "name and a valid level are required")
+			}
+			registry.SetLoggerLevel(body.Name, level)
+			return c.JSON(registry.Loggers())
+		case fiber.MethodDelete:
+			name := c.Query("name")
+			if name == "" {
+				return fiber.NewError(fiber.StatusBadRequest, "name is required")
+			}
+			registry.ResetLoggerLevel(name)
+			return c.JSON(registry.Loggers())
+		default:
+			return fiber.NewError(fiber.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package rmfiber
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+const LoggerLocalsKey = "rmlog_logger"
+
+// LoggerMiddleware binds a request-scoped logger derived from logger, with
+// trace_id, method, route, ip and user_id. The trace ID is also stored in
+// c.UserContext() under core.TraceIDKey. Pass rmlog.Log after Setup, it
+// follows reloads. Route and user are read when a record is logged, since
+// both are only known once routing and auth middleware ran, and are frozen
+// when the request ends so the logger stays safe to use afterwards.
+func LoggerMiddleware(logger *slog.Logger) fiber.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(c *fiber.Ctx) error {
+		return bindLogger(c, logger)
+	}
+}
+
+func bindLogger(c *fiber.Ctx, base *slog.Logger) error {
+	info := &requestInfo{c: c}
+
+	attrs := []any{
+		slog.String("method", c.Method()),
+		slog.Any("route", routeValue{info}),
+		slog.String("ip", c.IP()),
+		slog.Any("user_id", userIDValue{info}),
+	}
+	ctx := c.UserContext()
+	if traceID := requestTraceID(c); traceID != "" {
+		attrs = append([]any{slog.String(core.TraceIDKey, traceID)}, attrs...)
+		if core.GetTraceID(ctx) != traceID {
+			ctx = context.WithValue(ctx, core.TraceIDKey, traceID)
+		}
+	}
+
+	logger := base.With(attrs...)
+	c.Locals(LoggerLocalsKey, logger)
+	c.SetUserContext(core.ContextWithLogger(ctx, logger))
+
+	defer info.freeze()
+	return c.Next()
+}
+
+// Logger returns the request logger bound by LoggerMiddleware, or one
+// stored with rmlog.WithLogger in c.UserContext(), or slog.Default().
+func Logger(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals(LoggerLocalsKey).(*slog.Logger); ok {
+		return logger
+	}
+	if logger, ok := core.LoggerFromContext(c.UserContext()); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func requestTraceID(c *fiber.Ctx) string {
+	if traceID := core.GetTraceID(c.Context()); traceID != "" {
+		return traceID
+	}
+	if traceID := core.GetTraceID(c.UserContext()); traceID != "" {
+		return traceID
+	}
+	if tp, ok := core.TraceParentFromContext(c.UserContext()); ok {
+		return tp.TraceID
+	}
+	if tp, ok := core.ParseTraceParent(c.Get("traceparent")); ok {
+		return tp.TraceID
+	}
+	return ""
+}
+
+type requestInfo struct {
+	mu     sync.Mutex
+	c      *fiber.Ctx
+	route  string
+	userID string
+}
+
+func (r *requestInfo) load() (string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.c != nil {
+		r.route = r.c.Route().Path
+		r.userID = ""
+		if user, ok := r.c.Locals("user").(userIDProvider); ok {
+			r.userID = user.GetUserID()
+		}
+	}
+	return r.route, r.userID
+}
+
+func (r *requestInfo) freeze() {
+	r.load()
+	r.mu.Lock()
+	r.c = nil
+	r.mu.Unlock()
+}
+
+type routeValue struct{ info *requestInfo }
+
+func (v routeValue) LogValue() slog.Value {
+	route, _ := v.info.load()
+	return slog.StringValue(route)
+}
+
+type userIDValue struct{ info *requestInfo }
+
+// LogValue is an empty group without a user, which handlers drop.
+func (v userIDValue) LogValue() slog.Value {
+	_, userID := v.info.load()
+	if userID == "" {
+		return slog.GroupValue()
+	}
+	return slog.StringValue(userID)
+}
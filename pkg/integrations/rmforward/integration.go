@@ -0,0 +1,184 @@
+package rmforward
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Config struct {
+	// Network is "tcp" or "unix".
+	Network string
+	Address string
+	Tag     string
+	// RequireAck sends a chunk id with every message and waits for the ack.
+	RequireAck   bool
+	AckTimeout   time.Duration
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	Batch        core.BatchConfig
+}
+
+type event struct {
+	time   time.Time
+	record map[string]any
+}
+
+type Sink struct {
+	config  Config
+	batcher *core.Batcher[event]
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func New(config Config) (*Sink, error) {
+	if config.Network == "" {
+		config.Network = "tcp"
+	}
+	if config.Address == "" {
+		config.Address = "127.0.0.1:24224"
+	}
+	if config.Tag == "" {
+		config.Tag = "rmlog"
+	}
+	if config.AckTimeout == 0 {
+		config.AckTimeout = 10 * time.Second
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = 5 * time.Second
+	}
+
+	s := &Sink{config: config}
+	if err := s.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to forward endpoint: %w", err)
+	}
+	s.batcher = core.NewBatcher(config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	record := core.EntryToMap(entry)
+	delete(record, "time")
+
+	return s.batcher.Add(event{
+		time:   entry.Time,
+		record: record,
+	})
+}
+
+func (s *Sink) Flush() error {
+	return s.batcher.Flush()
+}
+
+func (s *Sink) Close() error {
+	err := s.batcher.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *Sink) send(events []event) error {
+	var chunk string
+	if s.config.RequireAck {
+		var id [16]byte
+		rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+	msg := encodePackedForward(s.config.Tag, events, chunk)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.write(msg, chunk); err == nil {
+		return nil
+	}
+
+	if err := s.reconnect(); err != nil {
+		return fmt.Errorf("failed to reconnect to forward endpoint: %w", err)
+	}
+	return s.write(msg, chunk)
+}
+
+func (s *Sink) write(msg []byte, chunk string) error {
+	if s.conn == nil {
+		return errors.New("forward connection is closed")
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+	if _, err := s.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(s.config.AckTimeout))
+	resp, err := readStringMap(s.reader)
+	if err != nil {
+		return fmt.Errorf("failed to read ack: %w", err)
+	}
+	if resp["ack"] != chunk {
+		return fmt.Errorf("unexpected ack %q for chunk %q", resp["ack"], chunk)
+	}
+	return nil
+}
+
+func (s *Sink) reconnect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return s.connect()
+}
+
+func (s *Sink) connect() error {
+	conn, err := net.DialTimeout(s.config.Network, s.config.Address, s.config.DialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// encodePackedForward builds [tag, entries, option] where entries is the
+// concatenated msgpack stream of [EventTime, record] pairs.
+func encodePackedForward(tag string, events []event, chunk string) []byte {
+	var entries encoder
+	for _, ev := range events {
+		entries.writeArrayHeader(2)
+		entries.writeEventTime(ev.time)
+		entries.writeMap(ev.record)
+	}
+
+	option := map[string]any{"size": len(events)}
+	if chunk != "" {
+		option["chunk"] = chunk
+	}
+
+	var msg encoder
+	msg.writeArrayHeader(3)
+	msg.writeString(tag)
+	msg.writeBinary(entries.bytes())
+	msg.writeMap(option)
+	return msg.bytes()
+}
@@ -0,0 +1,410 @@
+package rmforward
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 123_000_000, time.UTC)
+
+// frame is a decoded PackedForward message.
+type frame struct {
+	tag     string
+	times   []time.Time
+	records []map[string]any
+	option  map[string]any
+}
+
+// listenForward decodes every frame sent to it. ack decides the chunk id
+// written back for a frame that asks for one, by default the frame's own.
+func listenForward(t *testing.T, ack func(n int, chunk string) string) (string, <-chan frame) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan frame, 64)
+	go func() {
+		n := 0
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			for {
+				f, err := readFrame(r)
+				if err != nil {
+					conn.Close()
+					break
+				}
+				n++
+				received <- f
+
+				chunk, _ := f.option["chunk"].(string)
+				if chunk == "" {
+					continue
+				}
+				if ack != nil {
+					chunk = ack(n, chunk)
+				}
+				var resp encoder
+				resp.writeMap(map[string]any{"ack": chunk})
+				conn.Write(resp.bytes())
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	v, err := decodeValue(r)
+	if err != nil {
+		return frame{}, err
+	}
+	msg, ok := v.([]any)
+	if !ok || len(msg) != 3 {
+		return frame{}, fmt.Errorf("unexpected message %v", v)
+	}
+
+	f := frame{tag: msg[0].(string), option: msg[2].(map[string]any)}
+	entries := bytes.NewReader(msg[1].([]byte))
+	for entries.Len() > 0 {
+		v, err := decodeValue(entries)
+		if err != nil {
+			return frame{}, err
+		}
+		pair := v.([]any)
+		f.times = append(f.times, pair[0].(time.Time))
+		f.records = append(f.records, pair[1].(map[string]any))
+	}
+	return f, nil
+}
+
+// decodeValue reads the subset of MessagePack the encoder produces, with
+// EventTime decoded to time.Time.
+func decodeValue(r io.Reader) (any, error) {
+	b, err := readByte(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return decodeMap(r, int(b&0x0f))
+	case b&0xf0 == 0x90:
+		return decodeArray(r, int(b&0x0f))
+	case b&0xe0 == 0xa0:
+		return readBytes(r, int(b&0x1f), true)
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2, 0xc3:
+		return b == 0xc3, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readLength(r, 1<<(b-0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n, false)
+	case 0xd9, 0xda, 0xdb:
+		n, err := readLength(r, 1<<(b-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n, true)
+	case 0xcb:
+		buf, err := readBytes(r, 8, false)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf.([]byte))), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		buf, err := readBytes(r, 1<<(b-0xcc), false)
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range buf.([]byte) {
+			u = u<<8 | uint64(c)
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		buf, err := readBytes(r, size, false)
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range buf.([]byte) {
+			u = u<<8 | uint64(c)
+		}
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xd7:
+		buf, err := readBytes(r, 9, false)
+		if err != nil {
+			return nil, err
+		}
+		data := buf.([]byte)
+		if data[0] != 0 {
+			return nil, fmt.Errorf("unexpected ext type %d", data[0])
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(data[1:5])), int64(binary.BigEndian.Uint32(data[5:9]))).UTC(), nil
+	case 0xdc, 0xdd:
+		n, err := readLength(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readLength(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMap(r, n)
+	}
+	return nil, fmt.Errorf("unexpected msgpack byte %#x", b)
+}
+
+func decodeMap(r io.Reader, n int) (any, error) {
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		key, err := decodeValue(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeValue(r)
+		if err != nil {
+			return nil, err
+		}
+		m[key.(string)] = value
+	}
+	return m, nil
+}
+
+func decodeArray(r io.Reader, n int) (any, error) {
+	a := make([]any, n)
+	for i := range a {
+		value, err := decodeValue(r)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = value
+	}
+	return a, nil
+}
+
+func readBytes(r io.Reader, n int, str bool) (any, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if str {
+		return string(buf), nil
+	}
+	return buf, nil
+}
+
+func receiveN(t *testing.T, received <-chan frame, n int) []frame {
+	t.Helper()
+
+	var frames []frame
+	timeout := time.After(2 * time.Second)
+	for len(frames) < n {
+		select {
+		case f := <-received:
+			frames = append(frames, f)
+		case <-timeout:
+			t.Fatalf("received %d of %d frames", len(frames), n)
+		}
+	}
+	return frames
+}
+
+func entry(msg string, attrs ...slog.Attr) core.Entry {
+	return core.Entry{Time: testTime, Level: slog.LevelInfo, Message: msg, Attrs: attrs}
+}
+
+func TestSinkFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		entries []core.Entry
+		frames  int
+		check   func(t *testing.T, frames []frame)
+	}{
+		{
+			name:    "packed forward message",
+			config:  Config{Tag: "app.api"},
+			entries: []core.Entry{entry("hello", slog.Int("n", -3), slog.Bool("ok", true), slog.Float64("ms", 1.5), slog.Group("http", slog.String("method", "GET")))},
+			frames:  1,
+			check: func(t *testing.T, frames []frame) {
+				f := frames[0]
+				if f.tag != "app.api" || f.option["size"] != int64(1) || f.option["chunk"] != nil {
+					t.Errorf("tag %s with option %v", f.tag, f.option)
+				}
+				if !f.times[0].Equal(testTime) {
+					t.Errorf("event time = %s, want %s", f.times[0], testTime)
+				}
+				record := f.records[0]
+				want := map[string]any{"message": "hello", "level": "INFO", "n": int64(-3), "ok": true, "ms": 1.5, "http": map[string]any{"method": "GET"}}
+				for key, value := range want {
+					if !reflect.DeepEqual(record[key], value) {
+						t.Errorf("%s = %#v, want %#v", key, record[key], value)
+					}
+				}
+				if _, ok := record["time"]; ok {
+					t.Error("time must only travel as EventTime")
+				}
+			},
+		},
+		{
+			name:    "batch size splits frames",
+			config:  Config{Batch: core.BatchConfig{MaxSize: 2, MaxPending: 100}},
+			entries: []core.Entry{entry("1"), entry("2"), entry("3"), entry("4"), entry("5")},
+			frames:  3,
+			check: func(t *testing.T, frames []frame) {
+				var sizes []int64
+				for _, f := range frames {
+					sizes = append(sizes, f.option["size"].(int64))
+				}
+				if !reflect.DeepEqual(sizes, []int64{2, 2, 1}) {
+					t.Errorf("frame sizes = %v, want [2 2 1]", sizes)
+				}
+			},
+		},
+		{
+			name:    "ack chunk",
+			config:  Config{RequireAck: true},
+			entries: []core.Entry{entry("acked")},
+			frames:  1,
+			check: func(t *testing.T, frames []frame) {
+				if chunk, _ := frames[0].option["chunk"].(string); chunk == "" {
+					t.Error("chunk id missing")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, received := listenForward(t, nil)
+
+			config := tt.config
+			config.Address = address
+			config.Batch.Interval = time.Hour
+			sink, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range tt.entries {
+				if err := sink.Write(context.Background(), e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, receiveN(t, received, tt.frames))
+		})
+	}
+}
+
+func TestSinkAck(t *testing.T) {
+	tests := []struct {
+		name    string
+		ack     func(n int, chunk string) string
+		frames  int
+		wantErr bool
+	}{
+		{name: "matching ack", frames: 1},
+		{name: "wrong ack is resent once", ack: func(n int, chunk string) string {
+			if n == 1 {
+				return "other"
+			}
+			return chunk
+		}, frames: 2},
+		{name: "wrong ack twice fails", ack: func(n int, chunk string) string { return "other" }, frames: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, received := listenForward(t, tt.ack)
+
+			sink, err := New(Config{Address: address, RequireAck: true, AckTimeout: time.Second, Batch: core.BatchConfig{Interval: time.Hour}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+
+			sink.Write(context.Background(), entry("acked"))
+			err = sink.Flush()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("flush error = %v, want error %v", err, tt.wantErr)
+			}
+
+			frames := receiveN(t, received, tt.frames)
+			if frames[0].option["chunk"] != frames[len(frames)-1].option["chunk"] {
+				t.Error("resent frame must keep its chunk id")
+			}
+		})
+	}
+}
+
+func TestEncodeCyclicValues(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	loop := &node{}
+	loop.Next = loop
+
+	self := map[string]any{}
+	self["self"] = self
+
+	ptr := new(any)
+	*ptr = ptr
+
+	for name, value := range map[string]any{"struct pointer": loop, "map": self, "pointer": ptr} {
+		t.Run(name, func(t *testing.T) {
+			done := make(chan []byte)
+			go func() {
+				var e encoder
+				e.writeMap(map[string]any{"v": value})
+				done <- e.bytes()
+			}()
+
+			select {
+			case data := <-done:
+				if _, err := decodeValue(bytes.NewReader(data)); err != nil {
+					t.Errorf("encoded value does not decode: %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("encoding did not terminate")
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package rmforward
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// maxDepth bounds how deep writeValue descends into nested values, so a map
+// that contains itself or a cyclic pointer chain cannot recurse forever.
+const maxDepth = 32
+
+// encoder is a minimal MessagePack writer covering the types Forward needs.
+type encoder struct {
+	buf   []byte
+	depth int
+}
+
+func (e *encoder) bytes() []byte {
+	return e.buf
+}
+
+func (e *encoder) writeNil() {
+	e.buf = append(e.buf, 0xc0)
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.buf = append(e.buf, 0xc3)
+	} else {
+		e.buf = append(e.buf, 0xc2)
+	}
+}
+
+func (e *encoder) writeInt(v int64) {
+	switch {
+	case v >= 0:
+		e.writeUint(uint64(v))
+	case v >= -32:
+		e.buf = append(e.buf, byte(v))
+	case v >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+	case v >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+	}
+}
+
+func (e *encoder) writeUint(v uint64) {
+	switch {
+	case v <= 127:
+		e.buf = append(e.buf, byte(v))
+	case v <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+	case v <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+	}
+}
+
+func (e *encoder) writeFloat(v float64) {
+	e.buf = append(e.buf, 0xcb)
+	e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *encoder) writeString(v string) {
+	n := len(v)
+	switch {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdb)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) writeBinary(v []byte) {
+	n := len(v)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xc6)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xdc)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdd)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+func (e *encoder) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xde)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdf)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+// writeEventTime writes the Forward EventTime extension (fixext8, type 0).
+func (e *encoder) writeEventTime(t time.Time) {
+	e.buf = append(e.buf, 0xd7, 0x00)
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(t.Unix()))
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(t.Nanosecond()))
+}
+
+func (e *encoder) writeMap(m map[string]any) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	e.writeMapHeader(len(keys))
+	for _, key := range keys {
+		e.writeString(key)
+		e.writeValue(m[key])
+	}
+}
+
+func (e *encoder) writeValue(v any) {
+	if e.depth >= maxDepth {
+		e.writeString("<max depth exceeded>")
+		return
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	switch val := v.(type) {
+	case nil:
+		e.writeNil()
+	case bool:
+		e.writeBool(val)
+	case int:
+		e.writeInt(int64(val))
+	case int8:
+		e.writeInt(int64(val))
+	case int16:
+		e.writeInt(int64(val))
+	case int32:
+		e.writeInt(int64(val))
+	case int64:
+		e.writeInt(val)
+	case uint:
+		e.writeUint(uint64(val))
+	case uint8:
+		e.writeUint(uint64(val))
+	case uint16:
+		e.writeUint(uint64(val))
+	case uint32:
+		e.writeUint(uint64(val))
+	case uint64:
+		e.writeUint(val)
+	case float32:
+		e.writeFloat(float64(val))
+	case float64:
+		e.writeFloat(val)
+	case string:
+		e.writeString(val)
+	case []byte:
+		e.writeBinary(val)
+	case time.Time:
+		e.writeString(val.Format(time.RFC3339Nano))
+	case time.Duration:
+		e.writeString(val.String())
+	case error:
+		e.writeString(val.Error())
+	case map[string]any:
+		e.writeMap(val)
+	case []any:
+		e.writeArrayHeader(len(val))
+		for _, item := range val {
+			e.writeValue(item)
+		}
+	case fmt.Stringer:
+		e.writeString(val.String())
+	default:
+		e.writeReflect(v)
+	}
+}
+
+func (e *encoder) writeReflect(v any) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		e.writeArrayHeader(rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			e.writeValue(rv.Index(i).Interface())
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]any, rv.Len())
+			iter := rv.MapRange()
+			for iter.Next() {
+				m[iter.Key().String()] = iter.Value().Interface()
+			}
+			e.writeMap(m)
+			return
+		}
+		e.writeString(fmt.Sprintf("%+v", v))
+	case reflect.Pointer:
+		if rv.IsNil() {
+			e.writeNil()
+			return
+		}
+		e.writeValue(rv.Elem().Interface())
+	default:
+		e.writeString(fmt.Sprintf("%+v", v))
+	}
+}
+
+var errUnsupportedType = errors.New("unsupported msgpack type")
+
+// readStringMap decodes a map with string keys and string values, which is
+// all the Forward ack response contains.
+func readStringMap(r io.Reader) (map[string]string, error) {
+	n, err := readMapHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func readMapHeader(r io.Reader) (int, error) {
+	b, err := readByte(r)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), nil
+	case b == 0xde:
+		return readLength(r, 2)
+	case b == 0xdf:
+		return readLength(r, 4)
+	default:
+		return 0, errUnsupportedType
+	}
+}
+
+func readString(r io.Reader) (string, error) {
+	b, err := readByte(r)
+	if err != nil {
+		return "", err
+	}
+
+	var n int
+	switch {
+	case b&0xe0 == 0xa0:
+		n = int(b & 0x1f)
+	case b == 0xd9, b == 0xc4:
+		n, err = readLength(r, 1)
+	case b == 0xda, b == 0xc5:
+		n, err = readLength(r, 2)
+	case b == 0xdb, b == 0xc6:
+		n, err = readLength(r, 4)
+	default:
+		return "", errUnsupportedType
+	}
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func readLength(r io.Reader, size int) (int, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(buf[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(buf)), nil
+	default:
+		return int(binary.BigEndian.Uint32(buf)), nil
+	}
+}
+
+func readByte(r io.Reader) (byte, error) {
+	var buf [1]byte
+	_, err := io.ReadFull(r, buf[:])
+	return buf[0], err
+}
@@ -0,0 +1,211 @@
+package rmgelf
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZlib
+)
+
+const (
+	DefaultChunkSize = 1420
+	maxChunks        = 128
+	chunkHeaderSize  = 12
+)
+
+type Config struct {
+	// Network is "udp" or "tcp", optionally with a 4 or 6 suffix.
+	Network     string
+	Address     string
+	Host        string
+	Compression Compression
+	// ChunkSize is the UDP datagram size, it must leave room for the
+	// 12 byte chunk header.
+	ChunkSize int
+	// Fields are static additional fields, the "_" prefix is added automatically.
+	Fields       map[string]any
+	Batch        core.BatchConfig
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+type Sink struct {
+	config  Config
+	batcher *core.Batcher[[]byte]
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func New(config Config) (*Sink, error) {
+	if config.Network == "" {
+		config.Network = "udp"
+	}
+	if config.Host == "" {
+		config.Host, _ = os.Hostname()
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultChunkSize
+	}
+	if config.ChunkSize <= chunkHeaderSize {
+		return nil, fmt.Errorf("gelf chunk size must be larger than %d, got %d", chunkHeaderSize, config.ChunkSize)
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = 5 * time.Second
+	}
+
+	s := &Sink{config: config}
+	if err := s.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to graylog: %w", err)
+	}
+	s.batcher = core.NewBatcher(config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	msg, err := encodeMessage(s.config, entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode gelf message: %w", err)
+	}
+	return s.batcher.Add(msg)
+}
+
+func (s *Sink) Flush() error {
+	return s.batcher.Flush()
+}
+
+func (s *Sink) Close() error {
+	err := s.batcher.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+		s.conn = nil
+	}
+	return err
+}
+
+// send retries once on a new connection, starting after the last message
+// that was fully written so nothing is delivered twice.
+func (s *Sink) send(batch [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent, err := s.sendBatch(batch)
+	if err == nil {
+		return nil
+	}
+
+	if err := s.reconnect(); err != nil {
+		return fmt.Errorf("failed to reconnect to graylog: %w", err)
+	}
+	_, err = s.sendBatch(batch[sent:])
+	return err
+}
+
+// sendBatch returns how many messages of batch were written completely.
+func (s *Sink) sendBatch(batch [][]byte) (int, error) {
+	if s.conn == nil {
+		return 0, errors.New("graylog connection is closed")
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+
+	if !strings.HasPrefix(s.config.Network, "udp") {
+		var frame []byte
+		for _, msg := range batch {
+			frame = append(frame, msg...)
+			frame = append(frame, 0)
+		}
+		n, err := s.conn.Write(frame)
+		if err == nil {
+			return len(batch), nil
+		}
+
+		sent := 0
+		for _, msg := range batch {
+			if n < len(msg)+1 {
+				break
+			}
+			n -= len(msg) + 1
+			sent++
+		}
+		return sent, err
+	}
+
+	for i, msg := range batch {
+		payload, err := compress(s.config.Compression, msg)
+		if err != nil {
+			return i, err
+		}
+		if err := s.writeChunked(payload); err != nil {
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
+
+func (s *Sink) writeChunked(payload []byte) error {
+	if len(payload) <= s.config.ChunkSize {
+		_, err := s.conn.Write(payload)
+		return err
+	}
+
+	dataSize := s.config.ChunkSize - chunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > maxChunks {
+		return fmt.Errorf("gelf message needs %d chunks, max is %d", count, maxChunks)
+	}
+
+	var id [8]byte
+	rand.Read(id[:])
+
+	chunk := make([]byte, 0, s.config.ChunkSize)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*dataSize, len(payload))
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*dataSize:end]...)
+		if _, err := s.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sink) reconnect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return s.connect()
+}
+
+func (s *Sink) connect() error {
+	conn, err := net.DialTimeout(s.config.Network, s.config.Address, s.config.DialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
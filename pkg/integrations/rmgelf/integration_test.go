@@ -0,0 +1,385 @@
+package rmgelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 500_000_000, time.UTC)
+
+func testEntry(msg string, attrs ...slog.Attr) core.Entry {
+	return core.Entry{Time: testTime, Level: slog.LevelWarn, Message: msg, Attrs: attrs}
+}
+
+// listenUDP reassembles chunked and compressed datagrams into GELF messages.
+func listenUDP(t *testing.T) (string, <-chan map[string]any) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	received := make(chan map[string]any, 64)
+	go func() {
+		chunks := make(map[string][][]byte)
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			datagram := append([]byte(nil), buf[:n]...)
+
+			if len(datagram) > 12 && datagram[0] == 0x1e && datagram[1] == 0x0f {
+				id := string(datagram[2:10])
+				seq, count := int(datagram[10]), int(datagram[11])
+				if chunks[id] == nil {
+					chunks[id] = make([][]byte, count)
+				}
+				chunks[id][seq] = datagram[12:]
+
+				complete := true
+				for _, chunk := range chunks[id] {
+					complete = complete && chunk != nil
+				}
+				if !complete {
+					continue
+				}
+				datagram = bytes.Join(chunks[id], nil)
+				delete(chunks, id)
+			}
+
+			received <- decode(t, datagram)
+		}
+	}()
+	return conn.LocalAddr().String(), received
+}
+
+// listenTCP splits null-terminated frames, every accepted connection feeds
+// the same channel.
+func listenTCP(t *testing.T) (string, <-chan map[string]any) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan map[string]any, 64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					frame, err := r.ReadBytes(0)
+					if err != nil {
+						return
+					}
+					received <- decode(t, frame[:len(frame)-1])
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func decode(t *testing.T, data []byte) map[string]any {
+	var r io.Reader = bytes.NewReader(data)
+	switch {
+	case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Errorf("bad gzip payload: %v", err)
+			return nil
+		}
+		r = gz
+	case len(data) > 2 && data[0] == 0x78:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			t.Errorf("bad zlib payload: %v", err)
+			return nil
+		}
+		r = zr
+	}
+
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		t.Errorf("bad compressed payload: %v", err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Errorf("bad gelf payload %q: %v", payload, err)
+	}
+	return msg
+}
+
+func receiveN(t *testing.T, received <-chan map[string]any, n int) []map[string]any {
+	t.Helper()
+
+	var msgs []map[string]any
+	timeout := time.After(2 * time.Second)
+	for len(msgs) < n {
+		select {
+		case msg := <-received:
+			msgs = append(msgs, msg)
+		case <-timeout:
+			t.Fatalf("received %d of %d messages", len(msgs), n)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected extra message %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return msgs
+}
+
+func TestSinkWire(t *testing.T) {
+	long := strings.Repeat("0123456789", 300)
+
+	tests := []struct {
+		name    string
+		network string
+		config  Config
+		entries []core.Entry
+		check   func(t *testing.T, msgs []map[string]any)
+	}{
+		{
+			name:    "udp message fields",
+			network: "udp",
+			config:  Config{Host: "web-1", Fields: map[string]any{"env": "prod"}},
+			entries: []core.Entry{func() core.Entry {
+				e := testEntry("first line\nsecond line", slog.String("user", "ann"), slog.Int("id", 7), slog.Group("http", slog.Float64("ms", 1.5)))
+				e.TraceID = "abc"
+				e.File, e.Line = "main.go", 12
+				return e
+			}()},
+			check: func(t *testing.T, msgs []map[string]any) {
+				want := map[string]any{
+					"version":       "1.1",
+					"host":          "web-1",
+					"timestamp":     1709296245.5,
+					"level":         float64(4),
+					"short_message": "first line",
+					"full_message":  "first line\nsecond line",
+					"_env":          "prod",
+					"_user":         "ann",
+					"_id_":          float64(7),
+					"_http.ms":      1.5,
+					"_trace_id":     "abc",
+					"_file":         "main.go",
+					"_line":         float64(12),
+				}
+				for key, value := range want {
+					if msgs[0][key] != value {
+						t.Errorf("%s = %v, want %v", key, msgs[0][key], value)
+					}
+				}
+			},
+		},
+		{
+			name:    "udp chunking",
+			network: "udp",
+			config:  Config{ChunkSize: 200},
+			entries: []core.Entry{testEntry(long)},
+			check: func(t *testing.T, msgs []map[string]any) {
+				if msgs[0]["short_message"] != long {
+					t.Error("chunked message was not reassembled intact")
+				}
+			},
+		},
+		{
+			name:    "udp4 gzip",
+			network: "udp4",
+			config:  Config{Compression: CompressionGzip},
+			entries: []core.Entry{testEntry("gzipped")},
+			check: func(t *testing.T, msgs []map[string]any) {
+				if msgs[0]["short_message"] != "gzipped" {
+					t.Errorf("got %v", msgs[0])
+				}
+			},
+		},
+		{
+			name:    "udp zlib with chunks",
+			network: "udp",
+			config:  Config{Compression: CompressionZlib, ChunkSize: 64},
+			entries: []core.Entry{testEntry("zlib", slog.String("blob", long))},
+			check: func(t *testing.T, msgs []map[string]any) {
+				if msgs[0]["_blob"] != long {
+					t.Error("compressed chunked message was not reassembled intact")
+				}
+			},
+		},
+		{
+			name:    "tcp null framing keeps batch order",
+			network: "tcp",
+			config:  Config{Batch: core.BatchConfig{MaxSize: 3}},
+			entries: []core.Entry{testEntry("a"), testEntry("b"), testEntry("c"), testEntry("d")},
+			check: func(t *testing.T, msgs []map[string]any) {
+				for i, want := range []string{"a", "b", "c", "d"} {
+					if msgs[i]["short_message"] != want {
+						t.Errorf("message %d = %v, want %s", i, msgs[i]["short_message"], want)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var address string
+			var received <-chan map[string]any
+			if strings.HasPrefix(tt.network, "udp") {
+				address, received = listenUDP(t)
+			} else {
+				address, received = listenTCP(t)
+			}
+
+			config := tt.config
+			config.Network = tt.network
+			config.Address = address
+			config.Batch.Interval = time.Hour
+			sink, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+
+			for _, entry := range tt.entries {
+				if err := sink.Write(context.Background(), entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, receiveN(t, received, len(tt.entries)))
+		})
+	}
+}
+
+func TestNewRejectsSmallChunkSize(t *testing.T) {
+	for _, size := range []int{1, 11, 12} {
+		if _, err := New(Config{Address: "127.0.0.1:12201", ChunkSize: size}); err == nil {
+			t.Errorf("chunk size %d accepted", size)
+		}
+	}
+}
+
+// failingConn fails the write with index failAt once and passes the rest on.
+type failingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes int
+	failAt int
+}
+
+func (c *failingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes++
+	if c.writes == c.failAt {
+		return 0, errors.New("broken pipe")
+	}
+	return c.Conn.Write(b)
+}
+
+func TestSinkRetriesOnlyUnsentMessages(t *testing.T) {
+	address, received := listenUDP(t)
+
+	sink, err := New(Config{Network: "udp", Address: address, Batch: core.BatchConfig{Interval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	sink.mu.Lock()
+	sink.conn = &failingConn{Conn: sink.conn, failAt: 2}
+	sink.mu.Unlock()
+
+	for _, msg := range []string{"one", "two", "three"} {
+		sink.Write(context.Background(), testEntry(msg))
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := receiveN(t, received, 3)
+	for i, want := range []string{"one", "two", "three"} {
+		if msgs[i]["short_message"] != want {
+			t.Errorf("message %d = %v, want %s", i, msgs[i]["short_message"], want)
+		}
+	}
+}
+
+func TestSinkTCPPartialWriteResumes(t *testing.T) {
+	address, received := listenTCP(t)
+
+	sink, err := New(Config{Network: "tcp", Address: address, Batch: core.BatchConfig{Interval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	first, _ := encodeMessage(sink.config, testEntry("one"))
+	sink.mu.Lock()
+	sink.conn = &partialConn{Conn: sink.conn, limit: len(first) + 5}
+	sink.mu.Unlock()
+
+	for _, msg := range []string{"one", "two"} {
+		sink.Write(context.Background(), testEntry(msg))
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The two messages arrive on different connections, in either order.
+	got := make(map[any]int)
+	for _, msg := range receiveN(t, received, 2) {
+		got[msg["short_message"]]++
+	}
+	if got["one"] != 1 || got["two"] != 1 {
+		t.Errorf("got %v, want one and two exactly once", got)
+	}
+}
+
+// partialConn writes at most limit bytes and then fails, like a connection
+// reset in the middle of a frame.
+type partialConn struct {
+	net.Conn
+	limit int
+}
+
+func (c *partialConn) Write(b []byte) (int, error) {
+	if len(b) <= c.limit {
+		return c.Conn.Write(b)
+	}
+	n, _ := c.Conn.Write(b[:c.limit])
+	c.Conn.Close()
+	return n, errors.New("connection reset")
+}
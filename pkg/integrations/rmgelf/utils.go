@@ -0,0 +1,101 @@
+package rmgelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmsyslog"
+)
+
+func encodeMessage(config Config, entry core.Entry) ([]byte, error) {
+	msg := map[string]any{
+		"version":   "1.1",
+		"host":      config.Host,
+		"timestamp": float64(entry.Time.UnixMilli()) / 1000,
+		"level":     int(rmsyslog.SeverityFromLevel(entry.Level)),
+	}
+
+	shortMessage, _, multiline := strings.Cut(entry.Message, "\n")
+	msg["short_message"] = shortMessage
+	if multiline {
+		msg["full_message"] = entry.Message
+	}
+
+	for key, value := range config.Fields {
+		msg[fieldName(key)] = value
+	}
+	for _, attr := range core.FlattenAttrs(entry.Attrs) {
+		msg[fieldName(attr.Key)] = fieldValue(attr.Value)
+	}
+
+	if entry.TraceID != "" {
+		msg["_"+core.TraceIDKey] = entry.TraceID
+	}
+	if entry.File != "" {
+		msg["_file"] = entry.File
+		msg["_line"] = entry.Line
+	}
+
+	return json.Marshal(msg)
+}
+
+func fieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	if name == "id" {
+		name = "id_"
+	}
+	return "_" + name
+}
+
+func fieldValue(value slog.Value) any {
+	switch value.Kind() {
+	case slog.KindInt64:
+		return value.Int64()
+	case slog.KindUint64:
+		return value.Uint64()
+	case slog.KindFloat64:
+		return value.Float64()
+	default:
+		return value.String()
+	}
+}
+
+func compress(compression Compression, msg []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch compression {
+	case CompressionGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZlib:
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return msg, nil
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,187 @@
+package rmjournald
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmsyslog"
+)
+
+const DefaultSocketPath = "/run/systemd/journal/socket"
+
+// reservedFields are written by the sink itself, attributes that normalize
+// to one of them are prefixed with ATTR_ instead of duplicating the field.
+var reservedFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"TRACE_ID":          true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"SYSLOG_IDENTIFIER": true,
+}
+
+type Config struct {
+	SocketPath       string
+	SyslogIdentifier string
+	// Fields are static fields added to every entry, keys are normalized and
+	// fields the sink sets itself, such as MESSAGE, are ignored.
+	Fields map[string]string
+}
+
+type Sink struct {
+	config Config
+	static []byte
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+func New(config Config) (*Sink, error) {
+	if config.SocketPath == "" {
+		config.SocketPath = DefaultSocketPath
+	}
+	if config.SyslogIdentifier == "" && len(os.Args) > 0 {
+		config.SyslogIdentifier = filepath.Base(os.Args[0])
+	}
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journald socket: %w", err)
+	}
+
+	var static bytes.Buffer
+	if config.SyslogIdentifier != "" {
+		appendField(&static, "SYSLOG_IDENTIFIER", config.SyslogIdentifier)
+	}
+	for key, value := range config.Fields {
+		if name := fieldName(key); name != "" && !reservedFields[name] {
+			appendField(&static, name, value)
+		}
+	}
+
+	return &Sink{
+		config: config,
+		static: static.Bytes(),
+		conn:   conn,
+		addr:   &net.UnixAddr{Name: config.SocketPath, Net: "unixgram"},
+	}, nil
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	payload := s.encode(entry)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return errors.New("journald sink is closed")
+	}
+
+	_, _, err := s.conn.WriteMsgUnix(payload, nil, s.addr)
+	if err == nil {
+		return nil
+	}
+	if !isMessageTooLarge(err) {
+		return fmt.Errorf("failed to write to journald: %w", err)
+	}
+
+	return sendLarge(s.conn, s.addr, payload)
+}
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Sink) encode(entry core.Entry) []byte {
+	var b bytes.Buffer
+	b.Write(s.static)
+
+	appendField(&b, "MESSAGE", entry.Message)
+	appendField(&b, "PRIORITY", strconv.Itoa(int(rmsyslog.SeverityFromLevel(entry.Level))))
+	if entry.TraceID != "" {
+		appendField(&b, "TRACE_ID", entry.TraceID)
+	}
+	if entry.File != "" {
+		appendField(&b, "CODE_FILE", entry.File)
+		appendField(&b, "CODE_LINE", strconv.Itoa(entry.Line))
+	}
+	if entry.Function != "" {
+		appendField(&b, "CODE_FUNC", entry.Function)
+	}
+
+	for _, attr := range core.FlattenAttrs(entry.Attrs) {
+		name := fieldName(attr.Key)
+		if name == "" {
+			continue
+		}
+		if reservedFields[name] {
+			name = "ATTR_" + name
+		}
+		appendField(&b, name, attr.Value.String())
+	}
+
+	return b.Bytes()
+}
+
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+func appendField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// fieldName converts an attribute key to a journald field name: uppercase
+// letters, digits and underscores, not starting with an underscore or digit.
+func fieldName(key string) string {
+	name := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(name) < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			name = append(name, c-'a'+'A')
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			name = append(name, c)
+		default:
+			name = append(name, '_')
+		}
+	}
+
+	for len(name) > 0 && (name[0] == '_' || (name[0] >= '0' && name[0] <= '9')) {
+		name = name[1:]
+	}
+	return string(name)
+}
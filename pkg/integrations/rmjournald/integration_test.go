@@ -0,0 +1,228 @@
+package rmjournald
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type field struct {
+	name  string
+	value string
+}
+
+// parseFields decodes the journal native protocol, both NAME=value lines
+// and the binary NAME\n<length><value>\n form.
+func parseFields(t *testing.T, payload []byte) []field {
+	t.Helper()
+
+	var fields []field
+	for len(payload) > 0 {
+		line, rest, ok := bytes.Cut(payload, []byte("\n"))
+		if !ok {
+			t.Fatalf("unterminated field %q", payload)
+		}
+		if name, value, ok := bytes.Cut(line, []byte("=")); ok {
+			fields = append(fields, field{string(name), string(value)})
+			payload = rest
+			continue
+		}
+
+		if len(rest) < 8 {
+			t.Fatalf("binary field %s without length", line)
+		}
+		size := binary.LittleEndian.Uint64(rest[:8])
+		rest = rest[8:]
+		if uint64(len(rest)) < size+1 || rest[size] != '\n' {
+			t.Fatalf("binary field %s has bad length %d", line, size)
+		}
+		fields = append(fields, field{string(line), string(rest[:size])})
+		payload = rest[size+1:]
+	}
+	return fields
+}
+
+// listen opens a datagram socket standing in for journald and returns the
+// payload of every datagram, resolving memfd payloads with readRights.
+func listen(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadBuffer(4 << 20)
+	t.Cleanup(func() { conn.Close() })
+
+	received := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, 1<<20)
+		oob := make([]byte, 1024)
+		for {
+			n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+			if err != nil {
+				return
+			}
+			if oobn > 0 {
+				received <- readRights(t, oob[:oobn])
+				continue
+			}
+			received <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	return path, received
+}
+
+func receive(t *testing.T, received <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case payload := <-received:
+		return payload
+	case <-time.After(2 * time.Second):
+		t.Fatal("no datagram received")
+		return nil
+	}
+}
+
+func TestSinkFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		entry  core.Entry
+		want   []field
+	}{
+		{
+			name:   "message, priority and attrs",
+			config: Config{SyslogIdentifier: "app"},
+			entry: core.Entry{
+				Level:   slog.LevelError,
+				Message: "disk full",
+				Attrs:   []slog.Attr{slog.String("disk", "/dev/sda"), slog.Group("http", slog.Int("status", 500))},
+			},
+			want: []field{
+				{"SYSLOG_IDENTIFIER", "app"},
+				{"MESSAGE", "disk full"},
+				{"PRIORITY", "3"},
+				{"DISK", "/dev/sda"},
+				{"HTTP_STATUS", "500"},
+			},
+		},
+		{
+			name:   "trace id and source",
+			config: Config{SyslogIdentifier: "app"},
+			entry: core.Entry{
+				Level:    slog.LevelInfo,
+				Message:  "ok",
+				TraceID:  "abc",
+				File:     "/src/main.go",
+				Line:     42,
+				Function: "main.run",
+			},
+			want: []field{
+				{"SYSLOG_IDENTIFIER", "app"},
+				{"MESSAGE", "ok"},
+				{"PRIORITY", "6"},
+				{"TRACE_ID", "abc"},
+				{"CODE_FILE", "/src/main.go"},
+				{"CODE_LINE", "42"},
+				{"CODE_FUNC", "main.run"},
+			},
+		},
+		{
+			name:   "reserved attribute keys are prefixed",
+			config: Config{SyslogIdentifier: "app"},
+			entry: core.Entry{
+				Level:   slog.LevelWarn,
+				Message: "real",
+				Attrs: []slog.Attr{
+					slog.String("message", "fake"),
+					slog.String("priority", "0"),
+					slog.String("trace_id", "other"),
+				},
+			},
+			want: []field{
+				{"SYSLOG_IDENTIFIER", "app"},
+				{"MESSAGE", "real"},
+				{"PRIORITY", "4"},
+				{"ATTR_MESSAGE", "fake"},
+				{"ATTR_PRIORITY", "0"},
+				{"ATTR_TRACE_ID", "other"},
+			},
+		},
+		{
+			name:   "multiline values use the binary form",
+			config: Config{SyslogIdentifier: "app"},
+			entry: core.Entry{
+				Level:   slog.LevelError,
+				Message: "panic\ngoroutine 1",
+			},
+			want: []field{
+				{"SYSLOG_IDENTIFIER", "app"},
+				{"MESSAGE", "panic\ngoroutine 1"},
+				{"PRIORITY", "3"},
+			},
+		},
+		{
+			name:   "key normalization and static fields",
+			config: Config{SyslogIdentifier: "app", Fields: map[string]string{"env": "prod", "message": "ignored"}},
+			entry: core.Entry{
+				Level:   slog.LevelDebug,
+				Message: "x",
+				Attrs:   []slog.Attr{slog.String("_secret", "a"), slog.String("9lives", "b"), slog.String("user-id", "c")},
+			},
+			want: []field{
+				{"SYSLOG_IDENTIFIER", "app"},
+				{"ENV", "prod"},
+				{"MESSAGE", "x"},
+				{"PRIORITY", "7"},
+				{"SECRET", "a"},
+				{"LIVES", "b"},
+				{"USER_ID", "c"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, received := listen(t)
+
+			config := tt.config
+			config.SocketPath = path
+			sink, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+
+			if err := sink.Write(context.Background(), tt.entry); err != nil {
+				t.Fatal(err)
+			}
+			if got := parseFields(t, receive(t, received)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSinkClosed(t *testing.T) {
+	path, _ := listen(t)
+
+	sink, err := New(Config{SocketPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	if err := sink.Write(context.Background(), core.Entry{Message: "lost"}); err == nil {
+		t.Error("write after close succeeded")
+	}
+}
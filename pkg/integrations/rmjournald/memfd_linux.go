@@ -0,0 +1,38 @@
+//go:build linux
+
+package rmjournald
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// sendLarge passes the payload through a sealed memfd, as journald expects
+// for entries that do not fit into a single datagram.
+func sendLarge(conn *net.UnixConn, addr *net.UnixAddr, payload []byte) error {
+	fd, err := unix.MemfdCreate("rmlog-journal", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return fmt.Errorf("failed to create memfd: %w", err)
+	}
+	defer unix.Close(fd)
+
+	for written := 0; written < len(payload); {
+		n, err := unix.Write(fd, payload[written:])
+		if err != nil {
+			return fmt.Errorf("failed to write memfd: %w", err)
+		}
+		written += n
+	}
+
+	seals := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_ADD_SEALS, seals); err != nil {
+		return fmt.Errorf("failed to seal memfd: %w", err)
+	}
+
+	if _, _, err := conn.WriteMsgUnix(nil, unix.UnixRights(fd), addr); err != nil {
+		return fmt.Errorf("failed to send memfd to journald: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+package rmjournald
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+func readRights(t *testing.T, oob []byte) []byte {
+	messages, err := unix.ParseSocketControlMessage(oob)
+	if err != nil || len(messages) != 1 {
+		t.Errorf("bad control message: %v", err)
+		return nil
+	}
+	fds, err := unix.ParseUnixRights(&messages[0])
+	if err != nil || len(fds) != 1 {
+		t.Errorf("bad unix rights: %v", err)
+		return nil
+	}
+
+	file := os.NewFile(uintptr(fds[0]), "memfd")
+	defer file.Close()
+
+	seals, err := unix.FcntlInt(file.Fd(), unix.F_GET_SEALS, 0)
+	if err != nil || seals&unix.F_SEAL_WRITE == 0 {
+		t.Errorf("memfd is not sealed: %v", err)
+	}
+
+	// journald maps the memfd, the shared offset is still at the end of
+	// the sender's writes.
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<30))
+	if err != nil {
+		t.Errorf("failed to read memfd: %v", err)
+	}
+	return data
+}
+
+func TestSinkLargeEntryUsesMemfd(t *testing.T) {
+	path, received := listen(t)
+
+	sink, err := New(Config{SocketPath: path, SyslogIdentifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	large := strings.Repeat("x", 4<<20)
+	if err := sink.Write(context.Background(), core.Entry{Level: slog.LevelInfo, Message: large}); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := parseFields(t, receive(t, received))
+	if len(fields) != 3 || fields[1].name != "MESSAGE" || fields[1].value != large {
+		t.Errorf("large entry not delivered intact, got %d fields", len(fields))
+	}
+}
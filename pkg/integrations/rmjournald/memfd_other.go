@@ -0,0 +1,12 @@
+//go:build !linux
+
+package rmjournald
+
+import (
+	"errors"
+	"net"
+)
+
+func sendLarge(conn *net.UnixConn, addr *net.UnixAddr, payload []byte) error {
+	return errors.New("journald payload too large for a datagram")
+}
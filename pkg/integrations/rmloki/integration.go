@@ -0,0 +1,200 @@
+package rmloki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Config struct {
+	// URL is the push endpoint, e.g. http://loki:3100/loki/api/v1/push.
+	URL string
+	// Labels are static labels added to every stream.
+	Labels map[string]string
+	// LabelAttrs lists attribute keys promoted to stream labels.
+	LabelAttrs []string
+	// LevelLabel adds the record level as the "level" label.
+	LevelLabel bool
+	TenantID   string
+	Username   string
+	Password   string
+	Headers    map[string]string
+	Gzip       bool
+	Batch      core.BatchConfig
+	// Backoff defaults to core.DefaultBackoff when nil, an empty Backoff
+	// disables retries.
+	Backoff *core.Backoff
+	Client  *http.Client
+}
+
+type lokiEntry struct {
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+type Sink struct {
+	config     Config
+	labelAttrs map[string]string
+	batcher    *core.Batcher[lokiEntry]
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func New(config Config) (*Sink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("loki push URL is required")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Backoff == nil {
+		backoff := core.DefaultBackoff
+		config.Backoff = &backoff
+	}
+
+	labelAttrs := make(map[string]string, len(config.LabelAttrs))
+	for _, key := range config.LabelAttrs {
+		labelAttrs[key] = labelName(key)
+	}
+
+	s := &Sink{
+		config:     config,
+		labelAttrs: labelAttrs,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.batcher = core.NewBatcher(config.Batch, s.push)
+
+	return s, nil
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	labels := make(map[string]string, len(s.config.Labels)+len(s.labelAttrs)+1)
+	for name, value := range s.config.Labels {
+		labels[labelName(name)] = value
+	}
+	if s.config.LevelLabel {
+		labels["level"] = entry.Level.String()
+	}
+
+	attrs := entry.Attrs
+	if len(s.labelAttrs) > 0 {
+		attrs = make([]slog.Attr, 0, len(entry.Attrs))
+		for _, attr := range entry.Attrs {
+			if name, ok := s.labelAttrs[attr.Key]; ok {
+				labels[name] = attr.Value.String()
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+	}
+	entry.Attrs = attrs
+
+	line, err := json.Marshal(core.EntryToMap(entry))
+	if err != nil {
+		return fmt.Errorf("failed to encode loki line: %w", err)
+	}
+
+	return s.batcher.Add(lokiEntry{
+		labels: labels,
+		time:   entry.Time,
+		line:   string(line),
+	})
+}
+
+func (s *Sink) Flush() error {
+	return s.batcher.Flush()
+}
+
+// Close stops pending retry waits, so the final flush makes one attempt.
+func (s *Sink) Close() error {
+	s.cancel()
+	return s.batcher.Close()
+}
+
+func (s *Sink) push(batch []lokiEntry) error {
+	body, err := encodePush(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode loki push: %w", err)
+	}
+
+	contentEncoding := ""
+	if s.config.Gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return fmt.Errorf("failed to compress loki push: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to compress loki push: %w", err)
+		}
+		body = buf.Bytes()
+		contentEncoding = "gzip"
+	}
+
+	return core.Retry(s.ctx, *s.config.Backoff, func() error {
+		req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if contentEncoding != "" {
+			req.Header.Set("Content-Encoding", contentEncoding)
+		}
+		if s.config.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", s.config.TenantID)
+		}
+		if s.config.Username != "" {
+			req.SetBasicAuth(s.config.Username, s.config.Password)
+		}
+		for key, value := range s.config.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := s.config.Client.Do(req)
+		if err != nil {
+			return &core.RetryableError{Err: err}
+		}
+		defer resp.Body.Close()
+
+		return core.CheckHTTPResponse(resp)
+	})
+}
+
+type pushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func encodePush(batch []lokiEntry) ([]byte, error) {
+	streams := make(map[string]*pushStream)
+	var order []string
+
+	for _, e := range batch {
+		key := labelsKey(e.labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &pushStream{Stream: e.labels}
+			streams[key] = stream
+			order = append(order, key)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+	}
+
+	payload := struct {
+		Streams []*pushStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		payload.Streams = append(payload.Streams, streams[key])
+	}
+
+	return json.Marshal(payload)
+}
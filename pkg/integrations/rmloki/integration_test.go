@@ -0,0 +1,295 @@
+package rmloki
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+type pushRequest struct {
+	header  http.Header
+	streams []pushStream
+}
+
+// pushServer records every push and answers with the next status from
+// statuses, 204 once they run out.
+type pushServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	pushes   []pushRequest
+	statuses []int
+}
+
+func newPushServer(t *testing.T, statuses ...int) *pushServer {
+	t.Helper()
+
+	s := &pushServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("bad gzip body: %v", err)
+				return
+			}
+			body = gz
+		}
+
+		var payload struct {
+			Streams []pushStream `json:"streams"`
+		}
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			t.Errorf("bad push body: %v", err)
+		}
+
+		s.mu.Lock()
+		s.pushes = append(s.pushes, pushRequest{header: r.Header.Clone(), streams: payload.Streams})
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *pushServer) received() []pushRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pushRequest(nil), s.pushes...)
+}
+
+func fastBackoff(retries int) *core.Backoff {
+	return &core.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1, MaxRetries: retries}
+}
+
+func entry(level slog.Level, msg string, attrs ...slog.Attr) core.Entry {
+	return core.Entry{Time: testTime, Level: level, Message: msg, Attrs: attrs}
+}
+
+func TestSinkPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		entries []core.Entry
+		check   func(t *testing.T, pushes []pushRequest)
+	}{
+		{
+			name:    "streams are grouped by labels",
+			config:  Config{Labels: map[string]string{"app": "api"}, LabelAttrs: []string{"tenant"}, LevelLabel: true},
+			entries: []core.Entry{entry(slog.LevelInfo, "a", slog.String("tenant", "t1"), slog.Int("n", 1)), entry(slog.LevelInfo, "b", slog.String("tenant", "t2")), entry(slog.LevelInfo, "c", slog.String("tenant", "t1"))},
+			check: func(t *testing.T, pushes []pushRequest) {
+				if len(pushes) != 1 {
+					t.Fatalf("got %d pushes, want 1", len(pushes))
+				}
+				streams := pushes[0].streams
+				if len(streams) != 2 {
+					t.Fatalf("got %d streams, want 2", len(streams))
+				}
+				want := map[string]string{"app": "api", "level": "INFO", "tenant": "t1"}
+				if !reflect.DeepEqual(streams[0].Stream, want) {
+					t.Errorf("labels = %v, want %v", streams[0].Stream, want)
+				}
+				if len(streams[0].Values) != 2 || len(streams[1].Values) != 1 {
+					t.Errorf("values split %d/%d, want 2/1", len(streams[0].Values), len(streams[1].Values))
+				}
+
+				ts, line := streams[0].Values[0][0], streams[0].Values[0][1]
+				if ts != "1709296245000000000" {
+					t.Errorf("timestamp = %s", ts)
+				}
+				var decoded map[string]any
+				json.Unmarshal([]byte(line), &decoded)
+				if decoded["message"] != "a" || decoded["n"] != float64(1) || decoded["tenant"] != nil {
+					t.Errorf("line = %s, label attrs must not stay in the line", line)
+				}
+			},
+		},
+		{
+			name:    "headers, tenant, auth and gzip",
+			config:  Config{TenantID: "team-a", Username: "user", Password: "secret", Headers: map[string]string{"X-Extra": "1"}, Gzip: true},
+			entries: []core.Entry{entry(slog.LevelWarn, "zipped")},
+			check: func(t *testing.T, pushes []pushRequest) {
+				h := pushes[0].header
+				if h.Get("X-Scope-OrgID") != "team-a" || h.Get("X-Extra") != "1" || h.Get("Content-Encoding") != "gzip" {
+					t.Errorf("headers = %v", h)
+				}
+				if user, pass, ok := (&http.Request{Header: h}).BasicAuth(); !ok || user != "user" || pass != "secret" {
+					t.Error("basic auth missing")
+				}
+				if pushes[0].streams[0].Values[0][1] == "" {
+					t.Error("empty line")
+				}
+			},
+		},
+		{
+			name:    "batch size splits pushes",
+			config:  Config{Batch: core.BatchConfig{MaxSize: 2}},
+			entries: []core.Entry{entry(slog.LevelInfo, "1"), entry(slog.LevelInfo, "2"), entry(slog.LevelInfo, "3"), entry(slog.LevelInfo, "4"), entry(slog.LevelInfo, "5")},
+			check: func(t *testing.T, pushes []pushRequest) {
+				var sizes []int
+				for _, push := range pushes {
+					sizes = append(sizes, len(push.streams[0].Values))
+				}
+				if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+					t.Errorf("push sizes = %v, want [2 2 1]", sizes)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newPushServer(t)
+
+			config := tt.config
+			config.URL = server.URL
+			config.Batch.Interval = time.Hour
+			config.Batch.MaxPending = 100
+			sink, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range tt.entries {
+				if err := sink.Write(context.Background(), e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, server.received())
+		})
+	}
+}
+
+func TestSinkRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		backoff  *core.Backoff
+		attempts int
+		wantErr  bool
+	}{
+		{name: "server errors are retried", statuses: []int{500, 503}, backoff: fastBackoff(3), attempts: 3},
+		{name: "rate limit is retried", statuses: []int{429}, backoff: fastBackoff(3), attempts: 2},
+		{name: "client errors are not retried", statuses: []int{400}, backoff: fastBackoff(3), attempts: 1, wantErr: true},
+		{name: "retries run out", statuses: []int{500, 500, 500}, backoff: fastBackoff(2), attempts: 3, wantErr: true},
+		{name: "empty backoff disables retries", statuses: []int{500}, backoff: &core.Backoff{}, attempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newPushServer(t, tt.statuses...)
+
+			sink, err := New(Config{URL: server.URL, Backoff: tt.backoff, Batch: core.BatchConfig{Interval: time.Hour}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+
+			sink.Write(context.Background(), entry(slog.LevelError, "retry me"))
+			err = sink.Flush()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("flush error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := len(server.received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestNewDefaultsBackoff(t *testing.T) {
+	sink, err := New(Config{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.batcher.Close()
+
+	if *sink.config.Backoff != core.DefaultBackoff {
+		t.Errorf("backoff = %+v, want default", *sink.config.Backoff)
+	}
+}
+
+func TestCloseInterruptsRetry(t *testing.T) {
+	attempted := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := New(Config{
+		URL:     server.URL,
+		Backoff: &core.Backoff{Initial: time.Hour, MaxRetries: 5},
+		Batch:   core.BatchConfig{Interval: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.Write(context.Background(), entry(slog.LevelError, "stuck"))
+	flushed := make(chan error)
+	go func() { flushed <- sink.Flush() }()
+	<-attempted
+
+	start := time.Now()
+	sink.Close()
+	if err := <-flushed; err == nil {
+		t.Error("interrupted flush reported success")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s", elapsed)
+	}
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := New(Config{URL: server.URL, Backoff: fastBackoff(3), Batch: core.BatchConfig{Interval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	sink.Write(context.Background(), entry(slog.LevelError, "rate limited"))
+	start := time.Now()
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("flush waited %s for Retry-After", elapsed)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2", attempts)
+	}
+}
@@ -0,0 +1,176 @@
+package rmotlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Config struct {
+	// Endpoint is the OTLP/HTTP logs URL, e.g. http://collector:4318/v1/logs.
+	Endpoint       string
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+	// Resource holds additional resource attributes.
+	Resource  map[string]any
+	ScopeName string
+	Headers   map[string]string
+	Gzip      bool
+	Batch     core.BatchConfig
+	// Backoff defaults to core.DefaultBackoff when nil, an empty Backoff
+	// disables retries.
+	Backoff *core.Backoff
+	Client  *http.Client
+}
+
+type Exporter struct {
+	config   Config
+	resource resource
+	batcher  *core.Batcher[logRecord]
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func New(config Config) (*Exporter, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("otlp endpoint is required")
+	}
+	if config.ScopeName == "" {
+		config.ScopeName = "github.com/aeternitas-infinita/rmlog"
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Backoff == nil {
+		backoff := core.DefaultBackoff
+		config.Backoff = &backoff
+	}
+
+	resourceAttrs := make(map[string]any, len(config.Resource)+3)
+	for key, value := range config.Resource {
+		resourceAttrs[key] = value
+	}
+	if config.ServiceName != "" {
+		resourceAttrs["service.name"] = config.ServiceName
+	}
+	if config.ServiceVersion != "" {
+		resourceAttrs["service.version"] = config.ServiceVersion
+	}
+	if config.Environment != "" {
+		resourceAttrs["deployment.environment"] = config.Environment
+	}
+
+	e := &Exporter{
+		config:   config,
+		resource: resource{Attributes: mapToKeyValues(resourceAttrs)},
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.batcher = core.NewBatcher(config.Batch, e.export)
+
+	return e, nil
+}
+
+func (e *Exporter) Write(ctx context.Context, entry core.Entry) error {
+	record := logRecord{
+		TimeUnixNano:         strconv.FormatInt(entry.Time.UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		SeverityNumber:       SeverityNumber(entry.Level),
+		SeverityText:         entry.Level.String(),
+		Body:                 anyValue{StringValue: &entry.Message},
+		Attributes:           attrsToKeyValues(entry.Attrs),
+	}
+
+	if entry.File != "" {
+		record.Attributes = append(record.Attributes,
+			keyValue{Key: "code.filepath", Value: toAnyValue(entry.File)},
+			keyValue{Key: "code.lineno", Value: toAnyValue(int64(entry.Line))},
+		)
+	}
+	if entry.Function != "" {
+		record.Attributes = append(record.Attributes, keyValue{Key: "code.function", Value: toAnyValue(entry.Function)})
+	}
+
+	if tp, ok := core.TraceParentFromContext(ctx); ok {
+		record.TraceID = tp.TraceID
+		record.SpanID = tp.SpanID
+		record.Flags = uint32(tp.Flags)
+	} else if traceID := core.TraceIDToHex(entry.TraceID); traceID != "" {
+		record.TraceID = traceID
+	} else if entry.TraceID != "" {
+		record.Attributes = append(record.Attributes, keyValue{Key: core.TraceIDKey, Value: toAnyValue(entry.TraceID)})
+	}
+
+	return e.batcher.Add(record)
+}
+
+func (e *Exporter) Flush() error {
+	return e.batcher.Flush()
+}
+
+// Close stops pending retry waits, so the final flush makes one attempt.
+func (e *Exporter) Close() error {
+	e.cancel()
+	return e.batcher.Close()
+}
+
+func (e *Exporter) export(records []logRecord) error {
+	body, err := json.Marshal(exportRequest{
+		ResourceLogs: []resourceLogs{{
+			Resource: e.resource,
+			ScopeLogs: []scopeLogs{{
+				Scope:      scope{Name: e.config.ScopeName},
+				LogRecords: records,
+			}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode otlp request: %w", err)
+	}
+
+	if e.config.Gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return fmt.Errorf("failed to compress otlp request: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to compress otlp request: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	return core.Retry(e.ctx, *e.config.Backoff, func() error {
+		req, err := http.NewRequest(http.MethodPost, e.config.Endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if e.config.Gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		for key, value := range e.config.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := e.config.Client.Do(req)
+		if err != nil {
+			return &core.RetryableError{Err: err}
+		}
+		defer resp.Body.Close()
+
+		// OTLP/HTTP marks 502, 503 and 504 retryable, other 5xx are permanent.
+		if resp.StatusCode == http.StatusInternalServerError || resp.StatusCode == http.StatusNotImplemented {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return core.CheckHTTPResponse(resp)
+	})
+}
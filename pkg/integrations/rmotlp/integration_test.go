@@ -0,0 +1,314 @@
+package rmotlp
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+type collectorRequest struct {
+	header http.Header
+	body   exportRequest
+}
+
+// collector stands in for an OTLP/HTTP receiver and answers with the next
+// status from statuses, 200 once they run out.
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []collectorRequest
+	statuses []int
+}
+
+func newCollector(t *testing.T, statuses ...int) *collector {
+	t.Helper()
+
+	c := &collector{statuses: statuses}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("bad gzip body: %v", err)
+				return
+			}
+			body = gz
+		}
+
+		var req exportRequest
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			t.Errorf("bad export request: %v", err)
+		}
+
+		c.mu.Lock()
+		c.requests = append(c.requests, collectorRequest{header: r.Header.Clone(), body: req})
+		status := http.StatusOK
+		if len(c.statuses) > 0 {
+			status, c.statuses = c.statuses[0], c.statuses[1:]
+		}
+		c.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) received() []collectorRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]collectorRequest(nil), c.requests...)
+}
+
+func (r collectorRequest) records() []logRecord {
+	var records []logRecord
+	for _, rl := range r.body.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			records = append(records, sl.LogRecords...)
+		}
+	}
+	return records
+}
+
+func attribute(kvs []keyValue, key string) (anyValue, bool) {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return anyValue{}, false
+}
+
+func str(s string) *string { return &s }
+
+func TestExporterRecords(t *testing.T) {
+	traceParent := core.TraceParent{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: 1}
+
+	tests := []struct {
+		name   string
+		config Config
+		ctx    context.Context
+		entry  core.Entry
+		check  func(t *testing.T, req collectorRequest, record logRecord)
+	}{
+		{
+			name:   "resource, scope and record fields",
+			config: Config{ServiceName: "api", ServiceVersion: "1.2.0", Environment: "prod", Resource: map[string]any{"host.name": "web-1"}},
+			entry: core.Entry{
+				Time:    testTime,
+				Level:   slog.LevelWarn,
+				Message: "slow",
+				File:    "main.go",
+				Line:    7,
+				Attrs:   []slog.Attr{slog.Int("ms", 1200), slog.Group("http", slog.String("method", "GET"))},
+			},
+			check: func(t *testing.T, req collectorRequest, record logRecord) {
+				resource := req.body.ResourceLogs[0].Resource.Attributes
+				for key, want := range map[string]string{"service.name": "api", "service.version": "1.2.0", "deployment.environment": "prod", "host.name": "web-1"} {
+					if value, _ := attribute(resource, key); value.StringValue == nil || *value.StringValue != want {
+						t.Errorf("resource %s = %+v, want %s", key, value, want)
+					}
+				}
+				if scope := req.body.ResourceLogs[0].ScopeLogs[0].Scope.Name; scope != "github.com/aeternitas-infinita/rmlog" {
+					t.Errorf("scope = %s", scope)
+				}
+
+				if record.TimeUnixNano != "1709296245000000000" || record.SeverityNumber != 13 || record.SeverityText != "WARN" {
+					t.Errorf("record = %+v", record)
+				}
+				if record.Body.StringValue == nil || *record.Body.StringValue != "slow" {
+					t.Errorf("body = %+v", record.Body)
+				}
+				if ms, _ := attribute(record.Attributes, "ms"); ms.IntValue == nil || *ms.IntValue != "1200" {
+					t.Errorf("ms = %+v", ms)
+				}
+				httpGroup, _ := attribute(record.Attributes, "http")
+				want := &keyValueList{Values: []keyValue{{Key: "method", Value: anyValue{StringValue: str("GET")}}}}
+				if !reflect.DeepEqual(httpGroup.KvlistValue, want) {
+					t.Errorf("http = %+v", httpGroup)
+				}
+				if line, _ := attribute(record.Attributes, "code.lineno"); line.IntValue == nil || *line.IntValue != "7" {
+					t.Errorf("code.lineno = %+v", line)
+				}
+			},
+		},
+		{
+			name:  "trace parent from context",
+			ctx:   core.ContextWithTraceParent(context.Background(), traceParent),
+			entry: core.Entry{Time: testTime, Message: "traced", TraceID: "ignored"},
+			check: func(t *testing.T, req collectorRequest, record logRecord) {
+				if record.TraceID != traceParent.TraceID || record.SpanID != traceParent.SpanID || record.Flags != 1 {
+					t.Errorf("trace = %s/%s/%d", record.TraceID, record.SpanID, record.Flags)
+				}
+			},
+		},
+		{
+			name:  "uuid trace id becomes hex trace id",
+			entry: core.Entry{Time: testTime, Message: "uuid", TraceID: "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736"},
+			check: func(t *testing.T, req collectorRequest, record logRecord) {
+				if record.TraceID != traceParent.TraceID || record.SpanID != "" {
+					t.Errorf("trace = %s/%s", record.TraceID, record.SpanID)
+				}
+			},
+		},
+		{
+			name:  "other trace ids stay an attribute",
+			entry: core.Entry{Time: testTime, Message: "custom", TraceID: "req-42"},
+			check: func(t *testing.T, req collectorRequest, record logRecord) {
+				value, ok := attribute(record.Attributes, core.TraceIDKey)
+				if record.TraceID != "" || !ok || *value.StringValue != "req-42" {
+					t.Errorf("trace = %q, attribute = %+v", record.TraceID, value)
+				}
+			},
+		},
+		{
+			name:   "headers and gzip",
+			config: Config{Headers: map[string]string{"Authorization": "Bearer t"}, Gzip: true},
+			entry:  core.Entry{Time: testTime, Message: "zipped"},
+			check: func(t *testing.T, req collectorRequest, record logRecord) {
+				if req.header.Get("Authorization") != "Bearer t" || req.header.Get("Content-Encoding") != "gzip" || req.header.Get("Content-Type") != "application/json" {
+					t.Errorf("headers = %v", req.header)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCollector(t)
+
+			config := tt.config
+			config.Endpoint = server.URL + "/v1/logs"
+			config.Batch.Interval = time.Hour
+			exporter, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporter.Close()
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if err := exporter.Write(ctx, tt.entry); err != nil {
+				t.Fatal(err)
+			}
+			if err := exporter.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := server.received()
+			if len(requests) != 1 || len(requests[0].records()) != 1 {
+				t.Fatalf("got %d requests, want one with one record", len(requests))
+			}
+			tt.check(t, requests[0], requests[0].records()[0])
+		})
+	}
+}
+
+func TestExporterBatches(t *testing.T) {
+	server := newCollector(t)
+
+	exporter, err := New(Config{Endpoint: server.URL, Batch: core.BatchConfig{MaxSize: 3, Interval: time.Hour, MaxPending: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		exporter.Write(context.Background(), core.Entry{Time: testTime, Message: "m"})
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for _, req := range server.received() {
+		sizes = append(sizes, len(req.records()))
+	}
+	if !reflect.DeepEqual(sizes, []int{3, 3, 1}) {
+		t.Errorf("batch sizes = %v, want [3 3 1]", sizes)
+	}
+}
+
+func TestExporterRetry(t *testing.T) {
+	fast := &core.Backoff{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1, MaxRetries: 3}
+
+	tests := []struct {
+		name     string
+		statuses []int
+		backoff  *core.Backoff
+		attempts int
+		wantErr  bool
+	}{
+		{name: "unavailable is retried", statuses: []int{503, 502, 504}, backoff: fast, attempts: 4},
+		{name: "throttling is retried", statuses: []int{429}, backoff: fast, attempts: 2},
+		{name: "internal error is permanent", statuses: []int{500}, backoff: fast, attempts: 1, wantErr: true},
+		{name: "bad request is permanent", statuses: []int{400}, backoff: fast, attempts: 1, wantErr: true},
+		{name: "empty backoff disables retries", statuses: []int{503}, backoff: &core.Backoff{}, attempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCollector(t, tt.statuses...)
+
+			exporter, err := New(Config{Endpoint: server.URL, Backoff: tt.backoff, Batch: core.BatchConfig{Interval: time.Hour}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporter.Close()
+
+			exporter.Write(context.Background(), core.Entry{Time: testTime, Message: "retry"})
+			err = exporter.Flush()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("flush error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := len(server.received()); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestCloseInterruptsRetry(t *testing.T) {
+	attempted := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempted <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	exporter, err := New(Config{
+		Endpoint: server.URL,
+		Backoff:  &core.Backoff{Initial: time.Hour, MaxRetries: 5},
+		Batch:    core.BatchConfig{Interval: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter.Write(context.Background(), core.Entry{Time: testTime, Message: "stuck"})
+	flushed := make(chan error)
+	go func() { flushed <- exporter.Flush() }()
+	<-attempted
+
+	start := time.Now()
+	exporter.Close()
+	if err := <-flushed; err == nil {
+		t.Error("interrupted flush reported success")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("close took %s", elapsed)
+	}
+}
@@ -0,0 +1,165 @@
+package rmotlp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type exportRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	Flags                uint32     `json:"flags,omitempty"`
+	TraceID              string     `json:"traceId,omitempty"`
+	SpanID               string     `json:"spanId,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string       `json:"stringValue,omitempty"`
+	BoolValue   *bool         `json:"boolValue,omitempty"`
+	IntValue    *string       `json:"intValue,omitempty"`
+	DoubleValue *float64      `json:"doubleValue,omitempty"`
+	BytesValue  *string       `json:"bytesValue,omitempty"`
+	ArrayValue  *arrayValue   `json:"arrayValue,omitempty"`
+	KvlistValue *keyValueList `json:"kvlistValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+type keyValueList struct {
+	Values []keyValue `json:"values"`
+}
+
+// SeverityNumber maps slog levels onto the OpenTelemetry severity range,
+// slog.LevelInfo is INFO (9) and every slog step of 1 is one OTel step.
+func SeverityNumber(level slog.Level) int {
+	return min(max(int(level)+9, 1), 24)
+}
+
+func attrsToKeyValues(attrs []slog.Attr) []keyValue {
+	kvs := make([]keyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, keyValue{Key: attr.Key, Value: slogValueToAny(attr.Value)})
+	}
+	return kvs
+}
+
+func mapToKeyValues(m map[string]any) []keyValue {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]keyValue, 0, len(m))
+	for _, key := range keys {
+		kvs = append(kvs, keyValue{Key: key, Value: toAnyValue(m[key])})
+	}
+	return kvs
+}
+
+func slogValueToAny(value slog.Value) anyValue {
+	value = value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		return anyValue{KvlistValue: &keyValueList{Values: attrsToKeyValues(value.Group())}}
+	default:
+		return toAnyValue(value.Any())
+	}
+}
+
+func toAnyValue(v any) anyValue {
+	switch val := v.(type) {
+	case nil:
+		return anyValue{}
+	case string:
+		return anyValue{StringValue: &val}
+	case bool:
+		return anyValue{BoolValue: &val}
+	case int:
+		return intValue(int64(val))
+	case int64:
+		return intValue(val)
+	case int32:
+		return intValue(int64(val))
+	case uint64:
+		s := strconv.FormatUint(val, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &val}
+	case float32:
+		f := float64(val)
+		return anyValue{DoubleValue: &f}
+	case []byte:
+		s := base64.StdEncoding.EncodeToString(val)
+		return anyValue{BytesValue: &s}
+	case time.Duration:
+		s := val.String()
+		return anyValue{StringValue: &s}
+	case time.Time:
+		s := val.Format(time.RFC3339Nano)
+		return anyValue{StringValue: &s}
+	case error:
+		s := val.Error()
+		return anyValue{StringValue: &s}
+	case map[string]any:
+		return anyValue{KvlistValue: &keyValueList{Values: mapToKeyValues(val)}}
+	case fmt.Stringer:
+		s := val.String()
+		return anyValue{StringValue: &s}
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		values := make([]anyValue, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, toAnyValue(rv.Index(i).Interface()))
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+	}
+
+	s := fmt.Sprintf("%+v", v)
+	return anyValue{StringValue: &s}
+}
+
+func intValue(v int64) anyValue {
+	s := strconv.FormatInt(v, 10)
+	return anyValue{IntValue: &s}
+}
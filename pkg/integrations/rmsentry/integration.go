@@ -14,6 +14,9 @@ import (
 type Config struct {
 	FilterLevels  []slog.Level
 	ClientOptions sentry.ClientOptions
+	// MaxTagValueLength truncates tag values, 0 or anything above Sentry's
+	// own limit of 200 uses 200.
+	MaxTagValueLength int
 }
 
 type integration struct {
@@ -23,6 +26,11 @@ type integration struct {
 
 var globalIntegration = &integration{}
 
+const (
+	maxBreadcrumbs    = 100
+	maxTagValueLength = 200
+)
+
 func CaptureEvent(ctx context.Context, r slog.Record, args []slog.Attr) {
 	config := globalIntegration.config
 
@@ -42,18 +50,11 @@ func CaptureEvent(ctx context.Context, r slog.Record, args []slog.Attr) {
 		return
 	}
 
-	var sentryLevel sentry.Level
-	switch r.Level {
-	case slog.LevelDebug:
-		sentryLevel = sentry.LevelDebug
-	case slog.LevelInfo:
-		sentryLevel = sentry.LevelInfo
-	case slog.LevelWarn:
-		sentryLevel = sentry.LevelWarning
-	case slog.LevelError:
-		sentryLevel = sentry.LevelError
-	default:
-		sentryLevel = sentry.LevelInfo
+	sentryLevel := toSentryLevel(r.Level)
+
+	tagLimit := maxTagValueLength
+	if config.MaxTagValueLength > 0 && config.MaxTagValueLength < tagLimit {
+		tagLimit = config.MaxTagValueLength
 	}
 
 	tags, extra, errorValue := extractSentryData(args)
@@ -73,13 +74,17 @@ func CaptureEvent(ctx context.Context, r slog.Record, args []slog.Attr) {
 		scope.SetLevel(sentryLevel)
 
 		for key, value := range tags {
-			scope.SetTag(key, value)
+			scope.SetTag(key, core.TruncateString(value, tagLimit))
 		}
 
 		for key, value := range extra {
 			scope.SetExtra(key, value)
 		}
 
+		for _, breadcrumb := range recordsToBreadcrumbs(core.RecentRecords(ctx)) {
+			scope.AddBreadcrumb(breadcrumb, maxBreadcrumbs)
+		}
+
 		scope.SetContext("log_context", map[string]any{
 			"message":   r.Message,
 			"level":     r.Level.String(),
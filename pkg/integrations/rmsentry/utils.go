@@ -5,6 +5,8 @@ import (
 	"log/slog"
 	"runtime"
 	"strings"
+
+	"github.com/getsentry/sentry-go"
 )
 
 type SourceInfo struct {
@@ -60,3 +62,39 @@ func extractSentryData(attrs []slog.Attr) (map[string]string, map[string]interfa
 
 	return tags, extra, errorValue
 }
+
+func toSentryLevel(level slog.Level) sentry.Level {
+	switch level {
+	case slog.LevelDebug:
+		return sentry.LevelDebug
+	case slog.LevelInfo:
+		return sentry.LevelInfo
+	case slog.LevelWarn:
+		return sentry.LevelWarning
+	case slog.LevelError:
+		return sentry.LevelError
+	default:
+		return sentry.LevelInfo
+	}
+}
+
+func recordsToBreadcrumbs(records []slog.Record) []*sentry.Breadcrumb {
+	breadcrumbs := make([]*sentry.Breadcrumb, 0, len(records))
+	for _, r := range records {
+		data := make(map[string]interface{}, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			data[a.Key] = a.Value.Any()
+			return true
+		})
+
+		breadcrumbs = append(breadcrumbs, &sentry.Breadcrumb{
+			Type:      "default",
+			Category:  "log",
+			Message:   r.Message,
+			Data:      data,
+			Level:     toSentryLevel(r.Level),
+			Timestamp: r.Time,
+		})
+	}
+	return breadcrumbs
+}
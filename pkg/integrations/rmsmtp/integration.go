@@ -0,0 +1,180 @@
+package rmsmtp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net"
+	"net/smtp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmalert"
+)
+
+type TLSMode int
+
+const (
+	TLSStartTLS TLSMode = iota
+	TLSImplicit
+	TLSNone
+)
+
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+	TLS      TLSMode
+	// TLSConfig overrides the default TLS config, ServerName defaults to Host.
+	TLSConfig *tls.Config
+	// SubjectTemplate, TextTemplate and HTMLTemplate render an rmalert.Batch.
+	SubjectTemplate string
+	TextTemplate    string
+	HTMLTemplate    string
+	Timeout         time.Duration
+}
+
+type Mailer struct {
+	config  Config
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+}
+
+func NewMailer(config Config) (*Mailer, error) {
+	if config.Host == "" {
+		return nil, errors.New("smtp host is required")
+	}
+	if config.From == "" || len(config.To) == 0 {
+		return nil, errors.New("smtp from and to addresses are required")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+		if config.TLS == TLSImplicit {
+			config.Port = 465
+		}
+	}
+	if config.SubjectTemplate == "" {
+		config.SubjectTemplate = DefaultSubjectTemplate
+	}
+	if config.TextTemplate == "" {
+		config.TextTemplate = DefaultTextTemplate
+	}
+	if config.HTMLTemplate == "" {
+		config.HTMLTemplate = DefaultHTMLTemplate
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	subject, err := template.New("subject").Funcs(templateFuncs).Parse(config.SubjectTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse subject template: %w", err)
+	}
+	text, err := template.New("text").Funcs(templateFuncs).Parse(config.TextTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text template: %w", err)
+	}
+	html, err := htmltemplate.New("html").Funcs(templateFuncs).Parse(config.HTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html template: %w", err)
+	}
+
+	return &Mailer{
+		config:  config,
+		subject: subject,
+		text:    text,
+		html:    html,
+	}, nil
+}
+
+// New builds an alert sink that emails Error and higher records.
+func New(config rmalert.Config, smtpConfig Config) (*rmalert.Sink, error) {
+	mailer, err := NewMailer(smtpConfig)
+	if err != nil {
+		return nil, err
+	}
+	if config.Name == "" {
+		config.Name = "smtp"
+	}
+	return rmalert.NewSink(config, mailer), nil
+}
+
+func (m *Mailer) Notify(ctx context.Context, batch rmalert.Batch) error {
+	msg, err := m.buildMessage(batch)
+	if err != nil {
+		return err
+	}
+	return m.send(msg)
+}
+
+func (m *Mailer) send(msg []byte) error {
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	tlsConfig := m.config.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: m.config.Host}
+	}
+
+	dialer := &net.Dialer{Timeout: m.config.Timeout}
+	var conn net.Conn
+	var err error
+	if m.config.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(m.config.Timeout))
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer client.Close()
+
+	if m.config.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if m.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.config.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, to := range m.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,472 @@
+package rmsmtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmalert"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+// delivery is one message accepted by smtpServer.
+type delivery struct {
+	from string
+	to   []string
+	auth string
+	tls  bool
+	data []byte
+}
+
+// smtpServer is a minimal in-process SMTP server, enough for net/smtp.
+type smtpServer struct {
+	port      int
+	tlsConfig *tls.Config
+	// startTLS advertises STARTTLS, rejectRcpt answers 550 to that address.
+	startTLS   bool
+	rejectRcpt string
+
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+func newSMTPServer(t *testing.T, implicitTLS, startTLS bool, rejectRcpt string) (*smtpServer, *x509.CertPool) {
+	t.Helper()
+
+	cert, pool := selfSignedCert(t)
+	s := &smtpServer{
+		tlsConfig:  &tls.Config{Certificates: []tls.Certificate{cert}},
+		startTLS:   startTLS,
+		rejectRcpt: rejectRcpt,
+	}
+
+	var ln net.Listener
+	var err error
+	if implicitTLS {
+		ln, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s.port = ln.Addr().(*net.TCPAddr).Port
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, implicitTLS)
+		}
+	}()
+	return s, pool
+}
+
+func (s *smtpServer) serve(conn net.Conn, secure bool) {
+	defer func() { conn.Close() }()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 test ESMTP")
+
+	var current delivery
+	current.tls = secure
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-test")
+			if s.startTLS && !current.tls {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			current.tls = true
+		case "AUTH":
+			_, initial, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(initial)
+			current.auth = string(decoded)
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			current.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if to == s.rejectRcpt {
+				tp.PrintfLine("550 no such user")
+				continue
+			}
+			current.to = append(current.to, to)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.data = data
+			s.mu.Lock()
+			s.deliveries = append(s.deliveries, current)
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *smtpServer) received() []delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]delivery(nil), s.deliveries...)
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// parsedMail is a delivered message with its subject and parts decoded.
+type parsedMail struct {
+	header mail.Header
+	parts  map[string]string
+}
+
+func parseMail(t *testing.T, data []byte) parsedMail {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", msg.Header.Get("Content-Type"), err)
+	}
+
+	parsed := parsedMail{header: msg.Header, parts: make(map[string]string)}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Errorf("part encoding = %s", part.Header.Get("Content-Transfer-Encoding"))
+		}
+		content, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parsed.parts[contentType] = string(content)
+	}
+	return parsed
+}
+
+func (p parsedMail) subject(t *testing.T) string {
+	subject, err := new(mime.WordDecoder).DecodeHeader(p.header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subject
+}
+
+func testAlert(msg string) rmalert.Alert {
+	entry := core.Entry{
+		Time:    testTime,
+		Level:   slog.LevelError,
+		Message: msg,
+		TraceID: "abc",
+		Attrs:   []slog.Attr{slog.String("route", "/orders"), slog.String("error", "timeout")},
+	}
+	alert := rmalert.NewAlert(entry, "fp")
+	record := slog.NewRecord(testTime, slog.LevelInfo, "before", 0)
+	record.AddAttrs(slog.Int("step", 1))
+	alert.Context = []slog.Record{record}
+	return alert
+}
+
+func TestMailerDelivery(t *testing.T) {
+	tests := []struct {
+		name        string
+		implicitTLS bool
+		startTLS    bool
+		config      Config
+		batch       rmalert.Batch
+		check       func(t *testing.T, d delivery, m parsedMail)
+	}{
+		{
+			name:   "plain message",
+			config: Config{TLS: TLSNone},
+			batch:  rmalert.Batch{Alerts: []rmalert.Alert{testAlert("db <down>")}},
+			check: func(t *testing.T, d delivery, m parsedMail) {
+				if d.from != "alerts@example.com" || !reflect.DeepEqual(d.to, []string{"ops@example.com", "dev@example.com"}) {
+					t.Errorf("envelope %s -> %v", d.from, d.to)
+				}
+				if d.tls || d.auth != "" {
+					t.Errorf("tls %v, auth %q", d.tls, d.auth)
+				}
+				if got := m.subject(t); got != "[rmlog] [ERROR] db <down>" {
+					t.Errorf("subject = %q", got)
+				}
+				if m.header.Get("To") != "ops@example.com, dev@example.com" {
+					t.Errorf("to header = %q", m.header.Get("To"))
+				}
+
+				text := m.parts["text/plain"]
+				for _, want := range []string{"[ERROR] db <down>", "time: 2024-03-01 12:30:45 UTC", "route: /orders", "trace_id: abc", "error: timeout", "Preceding records:", "[INFO] before step=1"} {
+					if !strings.Contains(text, want) {
+						t.Errorf("text part misses %q:\n%s", want, text)
+					}
+				}
+				html := m.parts["text/html"]
+				if !strings.Contains(html, "db &lt;down&gt;") || strings.Contains(html, "db <down>") {
+					t.Errorf("html part is not escaped:\n%s", html)
+				}
+			},
+		},
+		{
+			name:   "digest subject",
+			config: Config{TLS: TLSNone},
+			batch:  rmalert.Batch{Alerts: []rmalert.Alert{testAlert("a"), testAlert("b")}, Digest: true},
+			check: func(t *testing.T, d delivery, m parsedMail) {
+				if got := m.subject(t); got != "[rmlog] 2 alert(s)" {
+					t.Errorf("subject = %q", got)
+				}
+				if text := m.parts["text/plain"]; !strings.Contains(text, "[ERROR] a") || !strings.Contains(text, "[ERROR] b") {
+					t.Errorf("text part = %s", text)
+				}
+			},
+		},
+		{
+			name:   "custom templates",
+			config: Config{TLS: TLSNone, SubjectTemplate: "{{len .Alerts}} problem", TextTemplate: "text {{(index .Alerts 0).Message}}", HTMLTemplate: "<p>{{(index .Alerts 0).Message}}</p>"},
+			batch:  rmalert.Batch{Alerts: []rmalert.Alert{testAlert("x")}},
+			check: func(t *testing.T, d delivery, m parsedMail) {
+				if m.subject(t) != "1 problem" || m.parts["text/plain"] != "text x" || m.parts["text/html"] != "<p>x</p>" {
+					t.Errorf("subject %q, parts %v", m.subject(t), m.parts)
+				}
+			},
+		},
+		{
+			name:     "starttls and auth",
+			startTLS: true,
+			config:   Config{TLS: TLSStartTLS, Username: "user", Password: "secret"},
+			batch:    rmalert.Batch{Alerts: []rmalert.Alert{testAlert("secure")}},
+			check: func(t *testing.T, d delivery, m parsedMail) {
+				if !d.tls || d.auth != "\x00user\x00secret" {
+					t.Errorf("tls %v, auth %q", d.tls, d.auth)
+				}
+			},
+		},
+		{
+			name:        "implicit tls",
+			implicitTLS: true,
+			config:      Config{TLS: TLSImplicit},
+			batch:       rmalert.Batch{Alerts: []rmalert.Alert{testAlert("secure")}},
+			check: func(t *testing.T, d delivery, m parsedMail) {
+				if !d.tls {
+					t.Error("message was not sent over tls")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, pool := newSMTPServer(t, tt.implicitTLS, tt.startTLS, "")
+
+			config := tt.config
+			config.Host = "127.0.0.1"
+			config.Port = server.port
+			config.From = "alerts@example.com"
+			config.To = []string{"ops@example.com", "dev@example.com"}
+			config.TLSConfig = &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+			config.Timeout = 2 * time.Second
+			mailer, err := NewMailer(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := mailer.Notify(context.Background(), tt.batch); err != nil {
+				t.Fatal(err)
+			}
+
+			deliveries := server.received()
+			if len(deliveries) != 1 {
+				t.Fatalf("got %d deliveries, want 1", len(deliveries))
+			}
+			tt.check(t, deliveries[0], parseMail(t, deliveries[0].data))
+		})
+	}
+}
+
+func TestMailerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		startTLS   bool
+		rejectRcpt string
+		config     Config
+		want       string
+	}{
+		{name: "starttls not offered", config: Config{TLS: TLSStartTLS}, want: "does not support STARTTLS"},
+		{name: "rejected recipient", rejectRcpt: "ops@example.com", config: Config{TLS: TLSNone}, want: "RCPT TO ops@example.com"},
+		{name: "unreachable server", config: Config{TLS: TLSNone, Port: 1}, want: "failed to connect"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newSMTPServer(t, false, tt.startTLS, tt.rejectRcpt)
+
+			config := tt.config
+			config.Host = "127.0.0.1"
+			if config.Port == 0 {
+				config.Port = server.port
+			}
+			config.From = "alerts@example.com"
+			config.To = []string{"ops@example.com"}
+			config.Timeout = 2 * time.Second
+			mailer, err := NewMailer(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = mailer.Notify(context.Background(), rmalert.Batch{Alerts: []rmalert.Alert{testAlert("x")}})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+			if got := len(server.received()); got != 0 {
+				t.Errorf("got %d deliveries, want none", got)
+			}
+		})
+	}
+}
+
+func TestNewMailerDefaults(t *testing.T) {
+	tests := []struct {
+		config Config
+		port   int
+	}{
+		{config: Config{Host: "smtp", From: "a@b", To: []string{"c@d"}}, port: 587},
+		{config: Config{Host: "smtp", From: "a@b", To: []string{"c@d"}, TLS: TLSImplicit}, port: 465},
+		{config: Config{Host: "smtp", From: "a@b", To: []string{"c@d"}, Port: 2525}, port: 2525},
+	}
+	for _, tt := range tests {
+		mailer, err := NewMailer(tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mailer.config.Port != tt.port {
+			t.Errorf("port = %d, want %d", mailer.config.Port, tt.port)
+		}
+	}
+
+	for name, config := range map[string]Config{
+		"missing host":      {From: "a@b", To: []string{"c@d"}},
+		"missing to":        {Host: "smtp", From: "a@b"},
+		"bad html template": {Host: "smtp", From: "a@b", To: []string{"c@d"}, HTMLTemplate: "{{.Alerts"},
+	} {
+		if _, err := NewMailer(config); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestSinkSendsMail(t *testing.T) {
+	server, _ := newSMTPServer(t, false, false, "")
+
+	sink, err := New(rmalert.Config{Name: t.Name()}, Config{
+		Host:    "127.0.0.1",
+		Port:    server.port,
+		From:    "alerts@example.com",
+		To:      []string{"ops@example.com"},
+		TLS:     TLSNone,
+		Timeout: 2 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.Write(context.Background(), core.Entry{Time: testTime, Level: slog.LevelInfo, Message: "ignored"})
+	sink.Write(context.Background(), core.Entry{Time: testTime, Level: slog.LevelError, Message: "failed"})
+	sink.Close()
+
+	deliveries := server.received()
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	if subject := parseMail(t, deliveries[0].data).subject(t); subject != "[rmlog] [ERROR] failed" {
+		t.Errorf("subject = %q", subject)
+	}
+	if stats := core.RegisterSinkCounters(t.Name()).Stats(); stats.Successes != 1 {
+		t.Errorf("stats = %+v, want one success", stats)
+	}
+}
@@ -0,0 +1,125 @@
+package rmsmtp
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmalert"
+)
+
+const DefaultSubjectTemplate = `{{if .Digest}}[rmlog] {{len .Alerts}} alert(s){{else}}{{with index .Alerts 0}}[rmlog] [{{.Level}}] {{.Message}}{{end}}{{end}}`
+
+const DefaultTextTemplate = `{{range .Alerts -}}
+[{{.Level}}] {{.Message}}
+time: {{.Time.Format "2006-01-02 15:04:05 MST"}}
+occurrences: {{.Count}}
+{{- if .Route}}
+route: {{.Route}}{{end}}
+{{- if .TraceID}}
+trace_id: {{.TraceID}}{{end}}
+{{- if .Error}}
+error: {{.Error}}{{end}}
+{{- if .Source}}
+source: {{.Source}}{{end}}
+{{- range $key, $value := .Attrs}}
+{{$key}}: {{$value}}{{end}}
+{{- if .Context}}
+
+Preceding records:
+{{- range .Context}}
+{{.Time.Format "15:04:05.000"}} [{{.Level}}] {{.Message}} {{recordAttrs .}}{{end}}{{end}}
+
+{{end}}`
+
+const DefaultHTMLTemplate = `<html><body>
+{{range .Alerts}}
+<h3>[{{.Level}}] {{.Message}}</h3>
+<table>
+<tr><td><b>time</b></td><td>{{.Time.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+<tr><td><b>occurrences</b></td><td>{{.Count}}</td></tr>
+{{if .Route}}<tr><td><b>route</b></td><td>{{.Route}}</td></tr>{{end}}
+{{if .TraceID}}<tr><td><b>trace_id</b></td><td>{{.TraceID}}</td></tr>{{end}}
+{{if .Error}}<tr><td><b>error</b></td><td>{{.Error}}</td></tr>{{end}}
+{{if .Source}}<tr><td><b>source</b></td><td>{{.Source}}</td></tr>{{end}}
+{{range $key, $value := .Attrs}}<tr><td><b>{{$key}}</b></td><td>{{$value}}</td></tr>{{end}}
+</table>
+{{if .Context}}<h4>Preceding records</h4>
+<pre>{{range .Context}}{{.Time.Format "15:04:05.000"}} [{{.Level}}] {{.Message}} {{recordAttrs .}}
+{{end}}</pre>{{end}}
+<hr>
+{{end}}
+</body></html>`
+
+var templateFuncs = map[string]any{
+	"recordAttrs": recordAttrs,
+}
+
+func recordAttrs(r slog.Record) string {
+	var attrs []string
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, fmt.Sprintf("%s=%s", a.Key, a.Value.String()))
+		return true
+	})
+	return strings.Join(attrs, " ")
+}
+
+func (m *Mailer) buildMessage(batch rmalert.Batch) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := m.subject.Execute(&subject, batch); err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := m.text.Execute(&text, batch); err != nil {
+		return nil, fmt.Errorf("failed to render text body: %w", err)
+	}
+	if err := m.html.Execute(&html, batch); err != nil {
+		return nil, fmt.Errorf("failed to render html body: %w", err)
+	}
+
+	var msg bytes.Buffer
+	body := multipart.NewWriter(&msg)
+
+	headers := []string{
+		"From: " + m.config.From,
+		"To: " + strings.Join(m.config.To, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.ReplaceAll(subject.String(), "\n", " ")),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", body.Boundary()),
+	}
+	header := strings.Join(headers, "\r\n") + "\r\n\r\n"
+
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(header), msg.Bytes()...), nil
+}
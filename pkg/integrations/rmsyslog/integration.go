@@ -0,0 +1,163 @@
+package rmsyslog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Format int
+
+const (
+	RFC5424 Format = iota
+	RFC3164
+)
+
+type Config struct {
+	// Network is "unix", "unixgram", "udp" or "tcp". Empty means the local
+	// syslog socket at Address (default /dev/log).
+	Network string
+	Address string
+	Format  Format
+	// Facility defaults to FacilityUser when nil, FacilityKern is 0 so it
+	// can only be selected through the pointer.
+	Facility *Facility
+	AppName  string
+	Hostname string
+	// StructuredDataID is the SD-ID used for attributes in RFC 5424 messages.
+	StructuredDataID string
+	DialTimeout      time.Duration
+	WriteTimeout     time.Duration
+}
+
+type Sink struct {
+	config   Config
+	facility Facility
+	pid      int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func New(config Config) (*Sink, error) {
+	if config.Network == "" && config.Address == "" {
+		config.Address = "/dev/log"
+	}
+	if config.AppName == "" {
+		config.AppName = appName()
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	if config.StructuredDataID == "" {
+		config.StructuredDataID = "rmlog@32473"
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = 5 * time.Second
+	}
+
+	s := &Sink{
+		config:   config,
+		facility: FacilityUser,
+		pid:      os.Getpid(),
+	}
+	if config.Facility != nil {
+		s.facility = *config.Facility
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	var msg []byte
+	if s.config.Format == RFC3164 {
+		msg = formatRFC3164(s.config, s.facility, s.pid, entry)
+	} else {
+		msg = formatRFC5424(s.config, s.facility, s.pid, entry)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.send(msg); err == nil {
+		return nil
+	}
+
+	if err := s.reconnect(); err != nil {
+		return fmt.Errorf("failed to reconnect to syslog: %w", err)
+	}
+	return s.send(msg)
+}
+
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Sink) send(msg []byte) error {
+	if s.conn == nil {
+		return errors.New("syslog connection is closed")
+	}
+
+	switch s.config.Network {
+	case "tcp", "tcp4", "tcp6":
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	case "unix":
+		msg = append(msg, '\n')
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *Sink) reconnect() error {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return s.connect()
+}
+
+func (s *Sink) connect() error {
+	if s.config.Network != "" {
+		conn, err := net.DialTimeout(s.config.Network, s.config.Address, s.config.DialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+		return nil
+	}
+
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		var conn net.Conn
+		conn, err = net.DialTimeout(network, s.config.Address, s.config.DialTimeout)
+		if err == nil {
+			s.conn = conn
+			s.config.Network = network
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,265 @@
+package rmsyslog
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var testTime = time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+
+func testEntry(level slog.Level, msg string, attrs ...slog.Attr) core.Entry {
+	return core.Entry{Time: testTime, Level: level, Message: msg, Attrs: attrs}
+}
+
+// listenUDP returns the listener address and a channel of received datagrams.
+func listenUDP(t *testing.T, network string) (string, <-chan string) {
+	t.Helper()
+
+	var conn net.PacketConn
+	var err error
+	if network == "unixgram" {
+		path := filepath.Join(t.TempDir(), "syslog.sock")
+		conn, err = net.ListenPacket("unixgram", path)
+	} else {
+		conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	received := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+		}
+	}()
+	return conn.LocalAddr().String(), received
+}
+
+// listenTCP accepts connections and delivers octet-counted frames.
+func listenTCP(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					length, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, err := strconv.Atoi(strings.TrimSpace(length))
+					if err != nil {
+						received <- "bad frame: " + length
+						return
+					}
+					frame := make([]byte, n)
+					if _, err := io.ReadFull(r, frame); err != nil {
+						return
+					}
+					received <- string(frame)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func receive(t *testing.T, received <-chan string) string {
+	t.Helper()
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func facility(f Facility) *Facility {
+	return &f
+}
+
+func TestSinkWire(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		config  Config
+		entry   core.Entry
+		want    *regexp.Regexp
+	}{
+		{
+			name:    "rfc5424 over udp",
+			network: "udp",
+			config:  Config{AppName: "app", Hostname: "host"},
+			entry:   testEntry(slog.LevelError, "disk full", slog.String("disk", "/dev/sda"), slog.Int("free", 0)),
+			want:    regexp.MustCompile(`^<11>1 2024-03-01T12:30:45Z host app \d+ - \[rmlog@32473 disk="/dev/sda" free="0"\] disk full$`),
+		},
+		{
+			name:    "rfc3164 over udp",
+			network: "udp",
+			config:  Config{AppName: "app", Hostname: "host", Format: RFC3164},
+			entry:   testEntry(slog.LevelWarn, "slow query", slog.Int("ms", 1200)),
+			want:    regexp.MustCompile(`^<12>Mar  1 12:30:45 host app\[\d+\]: slow query ms=1200$`),
+		},
+		{
+			name:    "kern facility",
+			network: "udp",
+			config:  Config{AppName: "app", Hostname: "host", Facility: facility(FacilityKern)},
+			entry:   testEntry(slog.LevelInfo, "boot"),
+			want:    regexp.MustCompile(`^<6>1 \S+ host app \d+ - - boot$`),
+		},
+		{
+			name:    "local7 facility",
+			network: "udp",
+			config:  Config{AppName: "app", Hostname: "host", Facility: facility(FacilityLocal7)},
+			entry:   testEntry(slog.LevelDebug, "tick"),
+			want:    regexp.MustCompile(`^<191>1 \S+ host app \d+ - - tick$`),
+		},
+		{
+			name:    "structured data escaping and groups",
+			network: "udp",
+			config:  Config{AppName: "app", Hostname: "host"},
+			entry: testEntry(slog.LevelInfo, "req",
+				slog.String("q", `a"b]c\d`),
+				slog.Group("http", slog.Int("status", 200)),
+			),
+			want: regexp.MustCompile(`^<14>1 \S+ host app \d+ - \[rmlog@32473 q="a\\"b\\]c\\\\d" http\.status="200"\] req$`),
+		},
+		{
+			name:    "trace id leads structured data",
+			network: "udp",
+			config:  Config{AppName: "app", Hostname: "host"},
+			entry: func() core.Entry {
+				e := testEntry(slog.LevelInfo, "traced", slog.String("k", "v"))
+				e.TraceID = "abc"
+				return e
+			}(),
+			want: regexp.MustCompile(`\[rmlog@32473 trace_id="abc" k="v"\] traced$`),
+		},
+		{
+			name:    "octet counting over tcp",
+			network: "tcp",
+			config:  Config{AppName: "app", Hostname: "host"},
+			entry:   testEntry(slog.LevelInfo, "framed"),
+			want:    regexp.MustCompile(`^<14>1 \S+ host app \d+ - - framed$`),
+		},
+		{
+			name:    "local unixgram socket",
+			network: "unixgram",
+			config:  Config{AppName: "app", Hostname: "host"},
+			entry:   testEntry(slog.LevelInfo, "local"),
+			want:    regexp.MustCompile(`^<14>1 \S+ host app \d+ - - local$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var address string
+			var received <-chan string
+			if tt.network == "tcp" {
+				address, received = listenTCP(t)
+			} else {
+				address, received = listenUDP(t, tt.network)
+			}
+
+			config := tt.config
+			config.Address = address
+			if tt.network != "unixgram" {
+				config.Network = tt.network
+			}
+
+			sink, err := New(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.Close()
+
+			if err := sink.Write(context.Background(), tt.entry); err != nil {
+				t.Fatal(err)
+			}
+			if got := receive(t, received); !tt.want.MatchString(got) {
+				t.Errorf("got %q, want match for %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSinkReconnects(t *testing.T) {
+	address, received := listenTCP(t)
+
+	sink, err := New(Config{Network: "tcp", Address: address, AppName: "app", Hostname: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(context.Background(), testEntry(slog.LevelInfo, "first")); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, received)
+
+	// A broken connection is replaced and the record resent on the new one.
+	sink.mu.Lock()
+	sink.conn.Close()
+	sink.mu.Unlock()
+
+	if err := sink.Write(context.Background(), testEntry(slog.LevelInfo, "second")); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, received); !strings.HasSuffix(got, " second") {
+		t.Errorf("got %q after reconnect", got)
+	}
+}
+
+func TestSinkReconnectFails(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := New(Config{Network: "tcp", Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ln.Close()
+	sink.mu.Lock()
+	sink.conn.Close()
+	sink.mu.Unlock()
+
+	if err := sink.Write(context.Background(), testEntry(slog.LevelInfo, "lost")); err == nil {
+		t.Error("write succeeded without a server to reconnect to")
+	}
+}
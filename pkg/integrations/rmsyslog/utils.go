@@ -0,0 +1,170 @@
+package rmsyslog
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type Facility int
+
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityLocal0 Facility = iota + 4
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+type Severity int
+
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+func SeverityFromLevel(level slog.Level) Severity {
+	switch {
+	case level > slog.LevelError:
+		return SeverityCritical
+	case level >= slog.LevelError:
+		return SeverityError
+	case level >= slog.LevelWarn:
+		return SeverityWarning
+	case level >= slog.LevelInfo:
+		return SeverityInfo
+	default:
+		return SeverityDebug
+	}
+}
+
+func priority(facility Facility, level slog.Level) int {
+	return int(facility)*8 + int(SeverityFromLevel(level))
+}
+
+func formatRFC5424(config Config, facility Facility, pid int, entry core.Entry) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		priority(facility, entry.Level),
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		headerField(config.Hostname, 255),
+		headerField(config.AppName, 48),
+		pid,
+	)
+
+	params := structuredParams(entry)
+	if len(params) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[")
+		b.WriteString(config.StructuredDataID)
+		for _, param := range params {
+			fmt.Fprintf(&b, ` %s="%s"`, sdName(param.Key), sdEscape(param.Value.String()))
+		}
+		b.WriteString("]")
+	}
+
+	if entry.Message != "" {
+		b.WriteString(" ")
+		b.WriteString(entry.Message)
+	}
+
+	return []byte(b.String())
+}
+
+func formatRFC3164(config Config, facility Facility, pid int, entry core.Entry) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<%d>%s %s %s[%d]: %s",
+		priority(facility, entry.Level),
+		entry.Time.Format(time.Stamp),
+		headerField(config.Hostname, 255),
+		headerField(config.AppName, 32),
+		pid,
+		entry.Message,
+	)
+
+	for _, param := range structuredParams(entry) {
+		fmt.Fprintf(&b, " %s=%s", param.Key, param.Value.String())
+	}
+
+	return []byte(b.String())
+}
+
+func structuredParams(entry core.Entry) []slog.Attr {
+	params := core.FlattenAttrs(entry.Attrs)
+	if entry.TraceID != "" {
+		params = append([]slog.Attr{slog.String(core.TraceIDKey, entry.TraceID)}, params...)
+	}
+	if entry.File != "" {
+		params = append(params, slog.String("source", fmt.Sprintf("%s:%d", entry.File, entry.Line)))
+	}
+	return params
+}
+
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+func sdName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
+
+func sdEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func appName() string {
+	if len(os.Args) == 0 {
+		return "rmlog"
+	}
+	return filepath.Base(os.Args[0])
+}
@@ -0,0 +1,222 @@
+package rmwebhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+type BodyFormat int
+
+const (
+	FormatJSONArray BodyFormat = iota
+	FormatNDJSON
+	FormatEnvelope
+)
+
+// Template renders a batch of records into a request body.
+type Template func(records []map[string]any) ([]byte, error)
+
+type Config struct {
+	// Name identifies the sink in rmlog.Health, defaults to "webhook:" plus
+	// the host and path of URL so sinks posting elsewhere keep apart.
+	Name   string
+	URL    string
+	Method string
+	Format BodyFormat
+	// EnvelopeField holds the records in FormatEnvelope, defaults to "records".
+	EnvelopeField string
+	// Envelope holds extra top level fields for FormatEnvelope.
+	Envelope map[string]any
+	// Template overrides Format when set.
+	Template    Template
+	ContentType string
+	Headers     map[string]string
+	BearerToken string
+	Username    string
+	Password    string
+	Gzip        bool
+	Batch       core.BatchConfig
+	// Backoff defaults to core.DefaultBackoff when nil, an empty Backoff
+	// disables retries.
+	Backoff *core.Backoff
+	Client  *http.Client
+}
+
+type Sink struct {
+	config   Config
+	template Template
+	counters *core.SinkCounters
+	batcher  *core.Batcher[map[string]any]
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func New(config Config) (*Sink, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook URL is required")
+	}
+	if config.Name == "" {
+		config.Name = defaultName(config.URL)
+	}
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+	if config.EnvelopeField == "" {
+		config.EnvelopeField = "records"
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if config.Backoff == nil {
+		backoff := core.DefaultBackoff
+		config.Backoff = &backoff
+	}
+
+	template := config.Template
+	if template == nil {
+		template = builtinTemplate(config)
+	}
+	if config.ContentType == "" {
+		config.ContentType = "application/json"
+		if config.Format == FormatNDJSON && config.Template == nil {
+			config.ContentType = "application/x-ndjson"
+		}
+	}
+
+	s := &Sink{
+		config:   config,
+		template: template,
+		counters: core.RegisterSinkCounters(config.Name),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.batcher = core.NewBatcher(config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *Sink) Name() string {
+	return s.config.Name
+}
+
+func (s *Sink) Write(ctx context.Context, entry core.Entry) error {
+	if err := s.batcher.Add(core.EntryToMap(entry)); err != nil {
+		s.counters.Failure(1, err)
+		return err
+	}
+	return nil
+}
+
+func (s *Sink) Flush() error {
+	return s.batcher.Flush()
+}
+
+// Close stops pending retry waits, so the final flush makes one attempt
+// and its failure shows up in rmlog.Health right away.
+func (s *Sink) Close() error {
+	s.cancel()
+	return s.batcher.Close()
+}
+
+func (s *Sink) send(records []map[string]any) error {
+	err := s.post(records)
+	if err != nil {
+		s.counters.Failure(len(records), err)
+		return fmt.Errorf("webhook %s: %w", s.config.Name, err)
+	}
+	s.counters.Success(len(records))
+	return nil
+}
+
+func (s *Sink) post(records []map[string]any) error {
+	body, err := s.template(records)
+	if err != nil {
+		return fmt.Errorf("failed to render body: %w", err)
+	}
+
+	if s.config.Gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return fmt.Errorf("failed to compress body: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to compress body: %w", err)
+		}
+		body = buf.Bytes()
+	}
+
+	return core.Retry(s.ctx, *s.config.Backoff, func() error {
+		req, err := http.NewRequest(s.config.Method, s.config.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", s.config.ContentType)
+		if s.config.Gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		switch {
+		case s.config.BearerToken != "":
+			req.Header.Set("Authorization", "Bearer "+s.config.BearerToken)
+		case s.config.Username != "":
+			req.SetBasicAuth(s.config.Username, s.config.Password)
+		}
+		for key, value := range s.config.Headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := s.config.Client.Do(req)
+		if err != nil {
+			return &core.RetryableError{Err: err}
+		}
+		defer resp.Body.Close()
+
+		return core.CheckHTTPResponse(resp)
+	})
+}
+
+func builtinTemplate(config Config) Template {
+	switch config.Format {
+	case FormatNDJSON:
+		return func(records []map[string]any) ([]byte, error) {
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return nil, err
+				}
+			}
+			return buf.Bytes(), nil
+		}
+	case FormatEnvelope:
+		return func(records []map[string]any) ([]byte, error) {
+			envelope := make(map[string]any, len(config.Envelope)+1)
+			for key, value := range config.Envelope {
+				envelope[key] = value
+			}
+			envelope[config.EnvelopeField] = records
+			return json.Marshal(envelope)
+		}
+	default:
+		return func(records []map[string]any) ([]byte, error) {
+			return json.Marshal(records)
+		}
+	}
+}
+
+// defaultName leaves out userinfo and query, they often carry credentials.
+func defaultName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "webhook"
+	}
+	return "webhook:" + u.Host + u.Path
+}
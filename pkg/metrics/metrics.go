@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+)
+
+var Default = NewRegistry()
+
+var (
+	RecordsTotal = Default.Counter("rmlog_records_total",
+		"Log records handled, by level and logger.", "level", "logger")
+	RecordsDropped = Default.Counter("rmlog_records_dropped_total",
+		"Log records dropped before reaching any output, by reason.", "reason")
+	RecordsSampled = Default.Counter("rmlog_records_sampled_total",
+		"Log records below the keep level that sampling let through.")
+	AttrsRedacted = Default.Counter("rmlog_attrs_redacted_total",
+		"Attribute values replaced by redaction.")
+	SinkErrors = Default.Counter("rmlog_sink_errors_total",
+		"Failed sink writes, by sink.", "sink")
+	SinkWriteSeconds = Default.Histogram("rmlog_sink_write_duration_seconds",
+		"Time spent handing a record to a sink, by sink.", nil, "sink")
+	ErriHandled = Default.Counter("rmlog_erri_handled_total",
+		"Errors passed to erri.Handle, by Erri type and HTTP status.", "type", "status")
+	HTTPPanics = Default.Counter("rmlog_http_panics_total",
+		"Panics recovered by rmfiber, by route template.", "route")
+	HTTPServerErrors = Default.Counter("rmlog_http_server_errors_total",
+		"5xx responses seen by rmfiber, by route template, status and handler.", "route", "status", "handler")
+)
+
+func init() {
+	Default.CounterFunc("rmlog_sink_records_total",
+		"Records delivered or failed by batching sinks, by sink and result.",
+		[]string{"sink", "result"}, collectSinkStats)
+}
+
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+func collectSinkStats() []Sample {
+	stats := core.AllSinkStats()
+	samples := make([]Sample, 0, len(stats)*2)
+	for _, s := range stats {
+		samples = append(samples,
+			Sample{LabelValues: []string{s.Name, "success"}, Value: float64(s.Successes)},
+			Sample{LabelValues: []string{s.Name, "failure"}, Value: float64(s.Failures)},
+		)
+	}
+	return samples
+}
@@ -0,0 +1,316 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OverflowValue replaces label values once a metric reaches its series limit.
+const OverflowValue = "other"
+
+const DefaultMaxSeries = 500
+
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+	order    []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+func (r *Registry) register(name string, f family) family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.families[name]; ok {
+		return existing
+	}
+	r.families[name] = f
+	r.order = append(r.order, name)
+	return f
+}
+
+func (r *Registry) Counter(name, help string, labelNames ...string) *CounterVec {
+	return r.register(name, &CounterVec{
+		vec: newVec(name, help, "counter", labelNames),
+	}).(*CounterVec)
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return r.register(name, &HistogramVec{
+		vec:     newVec(name, help, "histogram", labelNames),
+		buckets: buckets,
+	}).(*HistogramVec)
+}
+
+// CounterFunc registers a counter whose samples are collected at scrape time.
+func (r *Registry) CounterFunc(name, help string, labelNames []string, collect func() []Sample) {
+	r.register(name, &funcFamily{
+		name:       name,
+		help:       help,
+		kind:       "counter",
+		labelNames: labelNames,
+		collect:    collect,
+	})
+}
+
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := append([]string(nil), r.order...)
+	families := make([]family, 0, len(names))
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	maxSeries  int
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func newVec(name, help, kind string, labelNames []string) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		maxSeries:  DefaultMaxSeries,
+		series:     make(map[string]*series),
+	}
+}
+
+// get returns the series for labelValues, collapsing new label sets into
+// OverflowValue once maxSeries is reached. Callers hold v.mu.
+func (v *vec) get(labelValues []string, buckets int) *series {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+
+	if len(v.series) >= v.maxSeries {
+		overflow := make([]string, len(labelValues))
+		for i := range overflow {
+			overflow[i] = OverflowValue
+		}
+		labelValues = overflow
+		key = strings.Join(labelValues, "\xff")
+		if s, ok := v.series[key]; ok {
+			return s
+		}
+	}
+
+	s := &series{labelValues: append([]string(nil), labelValues...)}
+	if buckets > 0 {
+		s.counts = make([]uint64, buckets)
+	}
+	v.series[key] = s
+	return s
+}
+
+func (v *vec) sortedSeries() []*series {
+	all := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+	return all
+}
+
+func (v *vec) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+type CounterVec struct {
+	vec
+}
+
+// SetMaxSeries bounds the number of label sets, see OverflowValue.
+func (c *CounterVec) SetMaxSeries(n int) *CounterVec {
+	c.mu.Lock()
+	c.maxSeries = n
+	c.mu.Unlock()
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	c.get(labelValues, 0).value += value
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, s := range c.sortedSeries() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labelNames, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+func (h *HistogramVec) SetMaxSeries(n int) *HistogramVec {
+	h.mu.Lock()
+	h.maxSeries = n
+	h.mu.Unlock()
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues, len(h.buckets))
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, s := range h.sortedSeries() {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, s.labelValues, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labelNames, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+type funcFamily struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	collect    func() []Sample
+}
+
+func (f *funcFamily) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	for _, sample := range f.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labelNames, sample.LabelValues, "", ""), formatValue(sample.Value))
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
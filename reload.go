@@ -0,0 +1,216 @@
+package rmlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+)
+
+// Reload applies cfg like Setup and logs a "config reloaded" record with the
+// changed fields. An invalid cfg is logged and the current config stays.
+func Reload(cfg Config) error {
+	diff, err := apply(cfg)
+	if err != nil {
+		handler.Log.Error("config reload failed, keeping previous config", "error", err)
+		return err
+	}
+
+	handler.Log.LogAttrs(context.Background(), slog.LevelWarn, "config reloaded", slog.Any("diff", slog.GroupValue(diff...)))
+	return nil
+}
+
+// ReloadFromFile is LoadConfig followed by Reload.
+func ReloadFromFile(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		handler.Log.Error("config reload failed, keeping previous config", "path", path, "error", err)
+		return err
+	}
+	return Reload(cfg)
+}
+
+type WatchOptions struct {
+	// Path defaults to $RMLOG_CONFIG.
+	Path string
+	// Interval polls the file for changes, 0 disables polling.
+	Interval time.Duration
+	// SIGHUP reloads the file whenever the process receives SIGHUP.
+	SIGHUP bool
+}
+
+// Watch reloads the config file when its content changes or on SIGHUP,
+// until ctx is done. Polling compares mtime and size first and only hashes
+// the file when they moved, so touching it without edits is a no-op.
+func Watch(ctx context.Context, opts WatchOptions) error {
+	path := opts.Path
+	if path == "" {
+		path = os.Getenv(ConfigEnvKey)
+	}
+	if path == "" {
+		return errors.New("rmlog: watch needs a config path")
+	}
+	if opts.Interval <= 0 && !opts.SIGHUP {
+		return errors.New("rmlog: watch needs an interval or SIGHUP")
+	}
+
+	var hangup chan os.Signal
+	if opts.SIGHUP {
+		hangup = make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+	}
+
+	var tick <-chan time.Time
+	if opts.Interval > 0 {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last, _ := snapshotFile(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hangup:
+			last, _ = snapshotFile(path)
+			ReloadFromFile(path)
+		case <-tick:
+			current, err := statFile(path)
+			if err != nil {
+				continue
+			}
+			if current.modTime.Equal(last.modTime) && current.size == last.size {
+				continue
+			}
+			if err := current.hash(path); err != nil {
+				continue
+			}
+			changed := current.sum != last.sum
+			last = current
+			if changed {
+				ReloadFromFile(path)
+			}
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+}
+
+// statFile reads mtime and size only, callers hash when those changed.
+func statFile(path string) (fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func snapshotFile(path string) (fileState, error) {
+	state, err := statFile(path)
+	if err != nil {
+		return state, err
+	}
+	return state, state.hash(path)
+}
+
+func (s *fileState) hash(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.sum = sha256.Sum256(data)
+	return nil
+}
+
+// diffConfig lists what changed between two configs. Sentry settings and
+// sink credentials are reported as changed without their values.
+func diffConfig(old, new Config) []slog.Attr {
+	var diff []slog.Attr
+	change := func(key string, from, to any) {
+		if !reflect.DeepEqual(from, to) {
+			diff = append(diff, slog.Group(key, slog.Any("old", from), slog.Any("new", to)))
+		}
+	}
+
+	change("level", old.Level, new.Level)
+	change("loggers", old.Loggers, new.Loggers)
+	change("format", old.Format, new.Format)
+	change("source", old.Source, new.Source)
+	change("output", old.Output, new.Output)
+	change("filters", old.Filters, new.Filters)
+	change("redaction", old.Redaction.Keys, new.Redaction.Keys)
+	change("sampling", samplingString(old.Sampling), samplingString(new.Sampling))
+	change("limits", old.Limits, new.Limits)
+	change("span_threshold", time.Duration(old.SpanThreshold).String(), time.Duration(new.SpanThreshold).String())
+	if !reflect.DeepEqual(old.Sentry, new.Sentry) {
+		diff = append(diff, slog.String("sentry", "changed"))
+	}
+
+	oldKeys := make(map[string]bool)
+	for _, key := range sinkKeys(old.Sinks) {
+		oldKeys[key] = true
+	}
+	newKeys := make(map[string]bool)
+	var added, removed []string
+	for i, key := range sinkKeys(new.Sinks) {
+		newKeys[key] = true
+		if !oldKeys[key] {
+			added = append(added, sinkLabel(new.Sinks[i]))
+		}
+	}
+	for i, key := range sinkKeys(old.Sinks) {
+		if !newKeys[key] {
+			removed = append(removed, sinkLabel(old.Sinks[i]))
+		}
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		diff = append(diff, slog.Group("sinks", slog.Any("added", added), slog.Any("removed", removed)))
+	}
+
+	return diff
+}
+
+func samplingString(s SamplingConfig) string {
+	if s.Rate == nil {
+		return "off"
+	}
+	keepLevel := s.KeepLevel
+	if keepLevel == "" {
+		keepLevel = slog.LevelWarn.String()
+	}
+	return fmt.Sprintf("%v below %s", *s.Rate, keepLevel)
+}
+
+// sinkLabel names a sink for the reload diff. URLs lose their userinfo and
+// query, which is where webhook and Loki credentials usually live.
+func sinkLabel(sc SinkConfig) string {
+	if sc.Name != "" {
+		return sc.Type + ":" + sc.Name
+	}
+	if sc.URL != "" {
+		if u, err := url.Parse(sc.URL); err == nil && u.Host != "" {
+			return sc.Type + ":" + u.Host + u.Path
+		}
+		return sc.Type
+	}
+	if sc.Address != "" {
+		return sc.Type + ":" + sc.Address
+	}
+	return sc.Type
+}
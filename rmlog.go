@@ -2,6 +2,7 @@ package rmlog
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
 	"time"
@@ -17,14 +18,14 @@ var Log = slog.New(handler.NewCustomHandler(
 	core.GetLvlFromEnv("log_level"),
 	true,
 	false,
-))
+).SetName("main"))
 
 var LogMin = slog.New(handler.NewCustomHandler(
 	os.Stdout,
 	core.GetLvlFromEnv("log_level"),
 	false,
 	false,
-))
+).SetName("min"))
 
 func InitLog(cfg LoggerConfig) {
 	Log = CreateLogger(cfg)
@@ -35,14 +36,58 @@ func InitLogMin(cfg LoggerConfig) {
 }
 
 type LoggerConfig struct {
-	Level         slog.Level
-	SentryEnabled bool
-	AddSource     bool
+	Name           string
+	Level          slog.Level
+	SentryEnabled  bool
+	AddSource      bool
+	FlightRecorder *handler.FlightRecorderConfig
+	Schema         *handler.Schema
+	Limits         *handler.Limits
+	Sinks          []core.Sink
+	Hooks          []handler.Hook
+	Filter         *handler.Filter
 }
 
 func CreateLogger(config LoggerConfig) *slog.Logger {
-	handler := handler.NewCustomHandler(os.Stdout, config.Level, config.AddSource, config.SentryEnabled)
-	return slog.New(handler)
+	customHandler := handler.NewCustomHandler(os.Stdout, config.Level, config.AddSource, config.SentryEnabled).
+		SetSchema(config.Schema).
+		SetLimits(config.Limits).
+		AddSink(config.Sinks...).
+		AddHook(config.Hooks...).
+		SetFilter(config.Filter)
+	if config.Name != "" {
+		customHandler.SetName(config.Name)
+	}
+	if config.FlightRecorder != nil {
+		return slog.New(handler.NewFlightRecorder(customHandler, *config.FlightRecorder))
+	}
+	return slog.New(customHandler)
+}
+
+var ErrNoFlightRecorder = errors.New("rmlog: Log has no flight recorder, see LoggerConfig.FlightRecorder")
+
+// DumpFlightRecorder dumps the flight recorder behind Log, also when Setup
+// installed it behind a swap handler.
+func DumpFlightRecorder(traceID string) error {
+	h := Log.Handler()
+	if swap, ok := h.(*handler.SwapHandler); ok {
+		h = swap.Current()
+	}
+	recorder, ok := h.(*handler.FlightRecorder)
+	if !ok {
+		return ErrNoFlightRecorder
+	}
+	return recorder.Dump(traceID)
+}
+
+type HealthReport struct {
+	Sinks []core.SinkStats
+}
+
+func Health() HealthReport {
+	return HealthReport{
+		Sinks: core.AllSinkStats(),
+	}
 }
 
 func TraceIDToFHCtx(ctx *fasthttp.RequestCtx) {
@@ -61,6 +106,17 @@ func ErrAttr(err error) slog.Attr {
 	return core.ErrAttr(err)
 }
 
+// Lazy defers fn until the record passes the level, filters and sampling.
+// fn runs at most once per record and a panic in it is logged as the value.
+func Lazy(key string, fn func() any) slog.Attr {
+	return core.Lazy(key, fn)
+}
+
+// LazyGroup is Lazy for a group of attributes.
+func LazyGroup(key string, fn func() []slog.Attr) slog.Attr {
+	return core.LazyGroup(key, fn)
+}
+
 func GetLvlFromStr(s string) slog.Level {
 	return core.GetLvlFromStr(s)
 }
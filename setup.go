@@ -0,0 +1,432 @@
+package rmlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/handler"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmelastic"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmforward"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmgelf"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmjournald"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmloki"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmotlp"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmsentry"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmsyslog"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/rmwebhook"
+)
+
+var setupState struct {
+	mu      sync.Mutex
+	applied bool
+	config  Config
+	sinks   map[string]core.Sink
+	writer  io.Writer
+	output  io.Closer
+
+	log, min, internal *handler.SwapHandler
+}
+
+// Setup validates cfg and rebuilds Log, LogMin and handler.Log from it. The
+// three loggers share output, sinks, filters, redaction and sampling; Log
+// uses the configured source mode, the other two never add source.
+//
+// Calling Setup again swaps the configuration in place: loggers derived
+// from the previous one follow the change, sinks whose settings did not
+// change are kept open and the rest are closed once in-flight records
+// are written.
+func Setup(cfg Config) error {
+	_, err := apply(cfg)
+	return err
+}
+
+// SetupFromFile is LoadConfig followed by Setup.
+func SetupFromFile(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return Setup(cfg)
+}
+
+// Shutdown flushes and closes everything opened by Setup and SetupAudit.
+// Log, LogMin and handler.Log go back to stdout first, so records logged
+// afterwards never reach a closed sink or file.
+func Shutdown() error {
+	setupState.mu.Lock()
+	if setupState.log != nil {
+		level := core.GetLvlFromEnv("log_level")
+		setupState.log.Swap(handler.NewCustomHandler(os.Stdout, level, true, false).SetName("main"))
+		setupState.min.Swap(handler.NewCustomHandler(os.Stdout, level, false, false).SetName("min"))
+		setupState.internal.Swap(handler.NewCustomHandler(os.Stdout, slog.LevelError, false, false).SetName("internal"))
+	}
+	sinks, output := setupState.sinks, setupState.output
+	setupState.sinks, setupState.output = nil, nil
+	setupState.applied = false
+	setupState.mu.Unlock()
+
+	var errs []error
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if output != nil {
+		errs = append(errs, output.Close())
+	}
+	errs = append(errs, closeAudit())
+	rmsentry.Flush(2 * time.Second)
+	return errors.Join(errs...)
+}
+
+func apply(cfg Config) ([]slog.Attr, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	state := &setupState
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	level, _ := parseLevel(cfg.Level)
+
+	writer, closer := state.writer, state.output
+	outputChanged := !state.applied || cfg.Output != state.config.Output
+	if outputChanged {
+		var err error
+		writer, closer, err = openOutput(cfg.Output)
+		if err != nil {
+			return nil, &ConfigError{Field: "output", Err: err}
+		}
+	}
+
+	sinks, err := buildSinks(cfg.Sinks, state.sinks)
+	if err != nil {
+		if outputChanged && closer != nil {
+			closer.Close()
+		}
+		return nil, err
+	}
+	closeNew := func() {
+		for key, sink := range sinks {
+			if state.sinks[key] != sink {
+				sink.Close()
+			}
+		}
+		if outputChanged && closer != nil {
+			closer.Close()
+		}
+	}
+
+	sentryChanged := !reflect.DeepEqual(cfg.Sentry, state.config.Sentry) || cfg.Limits.MaxValueLength != state.config.Limits.MaxValueLength
+	if cfg.Sentry.Enabled && (!state.applied || sentryChanged) {
+		if err := initSentry(cfg.Sentry, cfg.Limits); err != nil {
+			closeNew()
+			return nil, &ConfigError{Field: "sentry", Err: err}
+		}
+	}
+
+	var filter *handler.Filter
+	if len(cfg.Filters) > 0 {
+		filter, _ = handler.CompileFilter(cfg.Filters...)
+	}
+	hooks := buildHooks(cfg)
+
+	format := handler.FormatText
+	if cfg.Format == "json" {
+		format = handler.FormatJSON
+	}
+
+	var limits *handler.Limits
+	if cfg.Limits != (LimitsConfig{}) {
+		limits = &handler.Limits{
+			MaxMessageLength: cfg.Limits.MaxMessageLength,
+			MaxValueLength:   cfg.Limits.MaxValueLength,
+			MaxAttrs:         cfg.Limits.MaxAttrs,
+			MaxRecordBytes:   cfg.Limits.MaxRecordBytes,
+		}
+	}
+
+	sinkList := make([]core.Sink, 0, len(sinks))
+	for _, key := range sinkKeys(cfg.Sinks) {
+		sinkList = append(sinkList, sinks[key])
+	}
+
+	newHandler := func(name string, source handler.SourceMode) *handler.CustomHandler {
+		return handler.NewCustomHandler(writer, level, false, cfg.Sentry.Enabled).
+			SetName(name).
+			SetFormat(format).
+			SetSourceMode(source).
+			SetLimits(limits).
+			AddSink(sinkList...).
+			AddHook(hooks...).
+			SetFilter(filter)
+	}
+
+	mainHandler := newHandler("main", parseSourceMode(cfg.Source))
+	minHandler := newHandler("min", handler.SourceNone)
+	internalHandler := newHandler("internal", handler.SourceNone)
+
+	if state.log == nil {
+		state.log = handler.NewSwapHandler(mainHandler)
+		state.min = handler.NewSwapHandler(minHandler)
+		state.internal = handler.NewSwapHandler(internalHandler)
+	} else {
+		state.log.Swap(mainHandler)
+		state.min.Swap(minHandler)
+		state.internal.Swap(internalHandler)
+	}
+	// The loggers are built once so references to them held elsewhere stay
+	// valid, they are only rebuilt if InitLog or InitLogMin replaced them.
+	if Log.Handler() != state.log {
+		Log = slog.New(state.log)
+	}
+	if LogMin.Handler() != state.min {
+		LogMin = slog.New(state.min)
+	}
+	if handler.Log.Handler() != state.internal {
+		handler.Log = slog.New(state.internal)
+	}
+
+	SetSpanThreshold(time.Duration(cfg.SpanThreshold))
+
+	for name := range state.config.Loggers {
+		ResetLoggerLevel(name)
+	}
+	for name, value := range cfg.Loggers {
+		loggerLevel, _ := parseLevel(value)
+		SetLoggerLevel(name, loggerLevel)
+	}
+
+	var diff []slog.Attr
+	if state.applied {
+		diff = diffConfig(state.config, cfg)
+	}
+
+	for key, sink := range state.sinks {
+		if sinks[key] != sink {
+			sink.Close()
+		}
+	}
+	if outputChanged && state.output != nil {
+		state.output.Close()
+	}
+
+	state.applied = true
+	state.config = cfg
+	state.sinks = sinks
+	state.writer, state.output = writer, closer
+	return diff, nil
+}
+
+func openOutput(output string) (io.Writer, io.Closer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil, nil
+	case "stderr":
+		return os.Stderr, nil, nil
+	default:
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, file, nil
+	}
+}
+
+func parseSourceMode(source string) handler.SourceMode {
+	switch source {
+	case "none":
+		return handler.SourceNone
+	case "short":
+		return handler.SourceShort
+	default:
+		return handler.SourceFull
+	}
+}
+
+func buildHooks(cfg Config) []handler.Hook {
+	var hooks []handler.Hook
+	if len(cfg.Redaction.Keys) > 0 {
+		hooks = append(hooks, handler.RedactHook(cfg.Redaction.Keys, cfg.Redaction.Replacement))
+	}
+	if cfg.Sampling.Rate != nil {
+		keepLevel := slog.LevelWarn
+		if cfg.Sampling.KeepLevel != "" {
+			keepLevel, _ = parseLevel(cfg.Sampling.KeepLevel)
+		}
+		hooks = append(hooks, handler.SamplingHook(*cfg.Sampling.Rate, keepLevel))
+	}
+	return hooks
+}
+
+func initSentry(cfg SentryConfig, limits LimitsConfig) error {
+	levels := []slog.Level{slog.LevelError}
+	if len(cfg.Levels) > 0 {
+		levels = levels[:0]
+		for _, name := range cfg.Levels {
+			level, _ := parseLevel(name)
+			levels = append(levels, level)
+		}
+	}
+
+	return rmsentry.Init(&rmsentry.Config{
+		FilterLevels:      levels,
+		MaxTagValueLength: limits.MaxValueLength,
+		ClientOptions: sentry.ClientOptions{
+			Dsn:         cfg.DSN,
+			Environment: cfg.Environment,
+			Release:     cfg.Release,
+			SampleRate:  cfg.SampleRate,
+		},
+	})
+}
+
+// buildSinks reuses sinks from previous whose settings are unchanged and
+// builds the rest.
+func buildSinks(configs []SinkConfig, previous map[string]core.Sink) (map[string]core.Sink, error) {
+	sinks := make(map[string]core.Sink, len(configs))
+	kept := make(map[string]bool)
+	for i, key := range sinkKeys(configs) {
+		if sink, ok := previous[key]; ok {
+			sinks[key] = sink
+			kept[key] = true
+			continue
+		}
+
+		sink, err := buildSink(configs[i])
+		if err != nil {
+			for key, sink := range sinks {
+				if !kept[key] {
+					sink.Close()
+				}
+			}
+			return nil, &ConfigError{Field: fmt.Sprintf("sinks[%d]", i), Err: err}
+		}
+		sinks[key] = sink
+	}
+	return sinks, nil
+}
+
+// sinkKeys identifies sinks by their full settings, identical entries are
+// told apart by occurrence.
+func sinkKeys(configs []SinkConfig) []string {
+	keys := make([]string, len(configs))
+	seen := make(map[string]int)
+	for i, sc := range configs {
+		data, _ := json.Marshal(sc)
+		key := string(data)
+		seen[key]++
+		keys[i] = fmt.Sprintf("%s#%d", key, seen[key])
+	}
+	return keys
+}
+
+func buildSink(sc SinkConfig) (core.Sink, error) {
+	batch := core.BatchConfig{
+		MaxSize:  sc.BatchSize,
+		Interval: time.Duration(sc.FlushInterval),
+	}
+
+	switch sc.Type {
+	case "syslog":
+		format := rmsyslog.RFC5424
+		if sc.Format == "rfc3164" {
+			format = rmsyslog.RFC3164
+		}
+		return rmsyslog.New(rmsyslog.Config{
+			Network: sc.Network,
+			Address: sc.Address,
+			Format:  format,
+			AppName: sc.Name,
+		})
+	case "journald":
+		return rmjournald.New(rmjournald.Config{
+			SocketPath:       sc.Address,
+			SyslogIdentifier: sc.Name,
+		})
+	case "gelf":
+		compression := rmgelf.CompressionNone
+		switch sc.Compression {
+		case "gzip":
+			compression = rmgelf.CompressionGzip
+		case "zlib":
+			compression = rmgelf.CompressionZlib
+		}
+		return rmgelf.New(rmgelf.Config{
+			Network:     sc.Network,
+			Address:     sc.Address,
+			Compression: compression,
+			Batch:       batch,
+		})
+	case "loki":
+		return rmloki.New(rmloki.Config{
+			URL:        sc.URL,
+			Labels:     sc.Labels,
+			LabelAttrs: sc.LabelAttrs,
+			LevelLabel: true,
+			Username:   sc.Username,
+			Password:   sc.Password,
+			Headers:    sc.Headers,
+			Gzip:       sc.Gzip,
+			Batch:      batch,
+		})
+	case "elasticsearch":
+		return rmelastic.New(rmelastic.Config{
+			URL:        sc.URL,
+			Index:      sc.Index,
+			DateLayout: sc.DateLayout,
+			Username:   sc.Username,
+			Password:   sc.Password,
+			APIKey:     sc.APIKey,
+			Headers:    sc.Headers,
+			Batch:      batch,
+		})
+	case "otlp":
+		return rmotlp.New(rmotlp.Config{
+			Endpoint:    sc.URL,
+			ServiceName: sc.ServiceName,
+			Headers:     sc.Headers,
+			Gzip:        sc.Gzip,
+			Batch:       batch,
+		})
+	case "webhook":
+		format := rmwebhook.FormatJSONArray
+		switch sc.Format {
+		case "ndjson":
+			format = rmwebhook.FormatNDJSON
+		case "envelope":
+			format = rmwebhook.FormatEnvelope
+		}
+		return rmwebhook.New(rmwebhook.Config{
+			Name:        sc.Name,
+			URL:         sc.URL,
+			Format:      format,
+			Headers:     sc.Headers,
+			BearerToken: sc.BearerToken,
+			Username:    sc.Username,
+			Password:    sc.Password,
+			Gzip:        sc.Gzip,
+			Batch:       batch,
+		})
+	case "forward":
+		return rmforward.New(rmforward.Config{
+			Network: sc.Network,
+			Address: sc.Address,
+			Tag:     sc.Tag,
+			Batch:   batch,
+		})
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+	}
+}
@@ -0,0 +1,204 @@
+package rmlog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aeternitas-infinita/rmlog/pkg/core"
+	"github.com/aeternitas-infinita/rmlog/pkg/integrations/erri"
+)
+
+const SpanKey = "span"
+
+const (
+	SpanStatusOK    = "OK"
+	SpanStatusError = "ERROR"
+)
+
+var spanThreshold atomic.Int64
+
+// SetSpanThreshold makes successful spans faster than d silent and logs
+// slower ones at warn. 0 logs every span at info.
+func SetSpanThreshold(d time.Duration) {
+	spanThreshold.Store(int64(d))
+}
+
+// Span times an operation and logs it once on End.
+type Span struct {
+	name      string
+	start     time.Time
+	pc        uintptr
+	ctx       context.Context
+	traceID   string
+	id        string
+	parentID  string
+	threshold time.Duration
+
+	mu    sync.Mutex
+	attrs []any
+	ended bool
+}
+
+// Start begins a span named op. The returned context carries the span as
+// W3C trace parent, so spans started from it become its children and sinks
+// such as OTLP attach its ids to records logged with it. A trace_id
+// already in ctx is kept as is, so records stay grouped with the rest of
+// the request, the trace parent carries its hex form.
+func Start(ctx context.Context, op string, args ...any) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var pcs [1]uintptr
+	runtime.Callers(2, pcs[:])
+
+	span := &Span{
+		name:      op,
+		start:     time.Now(),
+		pc:        pcs[0],
+		id:        randomHex(8),
+		attrs:     args,
+		threshold: time.Duration(spanThreshold.Load()),
+	}
+
+	parent, hasParent := core.TraceParentFromContext(ctx)
+	switch {
+	case hasParent:
+		span.traceID = parent.TraceID
+		span.parentID = parent.SpanID
+	case core.TraceIDToHex(core.GetTraceID(ctx)) != "":
+		span.traceID = core.TraceIDToHex(core.GetTraceID(ctx))
+	default:
+		span.traceID = randomHex(16)
+	}
+
+	ctx = core.ContextWithTraceParent(ctx, core.TraceParent{
+		TraceID: span.traceID,
+		SpanID:  span.id,
+		Flags:   parent.Flags,
+	})
+	if core.GetTraceID(ctx) == "" {
+		ctx = context.WithValue(ctx, core.TraceIDKey, span.traceID)
+	}
+	span.ctx = ctx
+
+	return ctx, span
+}
+
+// WithThreshold overrides SetSpanThreshold for this span.
+func (s *Span) WithThreshold(d time.Duration) *Span {
+	s.mu.Lock()
+	s.threshold = d
+	s.mu.Unlock()
+	return s
+}
+
+// Add attaches attributes logged on End.
+func (s *Span) Add(args ...any) {
+	s.mu.Lock()
+	s.attrs = append(s.attrs, args...)
+	s.mu.Unlock()
+}
+
+func (s *Span) ID() string {
+	return s.id
+}
+
+func (s *Span) ParentID() string {
+	return s.parentID
+}
+
+func (s *Span) TraceID() string {
+	return s.traceID
+}
+
+// End logs the span with its duration and status. Failed spans are always
+// logged, at warn for client errors and error otherwise. Only the first
+// call logs.
+func (s *Span) End(err error) time.Duration {
+	duration := time.Since(s.start)
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return duration
+	}
+	s.ended = true
+	attrs := s.attrs
+	threshold := s.threshold
+	s.mu.Unlock()
+
+	status, errorType, level := spanStatus(err)
+	slow := threshold > 0 && duration >= threshold
+	if err == nil {
+		if threshold > 0 && !slow {
+			return duration
+		}
+		if slow {
+			level = slog.LevelWarn
+		}
+	}
+
+	logger := FromContext(s.ctx)
+	if !logger.Enabled(s.ctx, level) {
+		return duration
+	}
+
+	spanAttrs := []any{
+		slog.String("id", s.id),
+		slog.Duration("duration", duration),
+		slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+		slog.String("status", status),
+	}
+	if errorType != "" {
+		spanAttrs = append(spanAttrs, slog.String("error_type", errorType))
+	}
+	if s.parentID != "" {
+		spanAttrs = append(spanAttrs, slog.String("parent_id", s.parentID))
+	}
+	if slow {
+		spanAttrs = append(spanAttrs, slog.Bool("slow", true))
+	}
+
+	r := slog.NewRecord(time.Now(), level, s.name, s.pc)
+	r.AddAttrs(slog.Group(SpanKey, spanAttrs...))
+	if err != nil {
+		r.AddAttrs(core.ErrAttr(err))
+	}
+	r.Add(attrs...)
+	logger.Handler().Handle(s.ctx, r)
+
+	return duration
+}
+
+// spanStatus maps err to SpanStatusOK or SpanStatusError, the erri type
+// of err, if any, is returned separately.
+func spanStatus(err error) (status, errorType string, level slog.Level) {
+	if err == nil {
+		return SpanStatusOK, "", slog.LevelInfo
+	}
+
+	var e *erri.Erri
+	if errors.As(err, &e) {
+		level := slog.LevelError
+		if e.HTTPStatusCode() < http.StatusInternalServerError {
+			level = slog.LevelWarn
+		}
+		return SpanStatusError, string(e.Type), level
+	}
+	return SpanStatusError, "", slog.LevelError
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}